@@ -0,0 +1,375 @@
+package exr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// V2i represents a two-dimensional vector with integer components.
+type V2i struct {
+	X int32
+	Y int32
+}
+
+// V2f represents a two-dimensional vector with float components.
+type V2f struct {
+	X float32
+	Y float32
+}
+
+// V2d represents a two-dimensional vector with double components.
+type V2d struct {
+	X float64
+	Y float64
+}
+
+// V3i represents a three-dimensional vector with integer components.
+type V3i struct {
+	X int32
+	Y int32
+	Z int32
+}
+
+// V3f represents a three-dimensional vector with float components.
+type V3f struct {
+	X float32
+	Y float32
+	Z float32
+}
+
+// V3d represents a three-dimensional vector with double components.
+type V3d struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+// Box2f represents a two-dimensional box with float coordinates. Unlike
+// image.Rectangle, the box contains its maximum point.
+type Box2f struct {
+	Min V2f
+	Max V2f
+}
+
+// M33f represents a 3x3 matrix with float components. The components are
+// stored in row-major order, as they are stored in the image.
+type M33f [3][3]float32
+
+// M33d represents a 3x3 matrix with double components. The components are
+// stored in row-major order, as they are stored in the image.
+type M33d [3][3]float64
+
+// M44f represents a 4x4 matrix with float components. The components are
+// stored in row-major order, as they are stored in the image.
+type M44f [4][4]float32
+
+// M44d represents a 4x4 matrix with double components. The components are
+// stored in row-major order, as they are stored in the image.
+type M44d [4][4]float64
+
+// Rational represents a rational number.
+type Rational struct {
+
+	// Numerator holds the numerator of the number.
+	Numerator int32
+
+	// Denominator holds the denominator of the number.
+	Denominator uint32
+}
+
+// Float64 returns the value of the rational number.
+func (r Rational) Float64() float64 {
+	return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// TimeCode represents a SMPTE time code.
+type TimeCode struct {
+
+	// TimeAndFlags holds the packed hours, minutes, seconds, frame and
+	// flags of the time code, as defined by SMPTE 12M.
+	TimeAndFlags uint32
+
+	// UserData holds the packed binary groups of the time code.
+	UserData uint32
+}
+
+// KeyCode represents a motion picture film frame identifier, as defined
+// by SMPTE 254.
+type KeyCode struct {
+	FilmMfcCode   int32
+	FilmType      int32
+	Prefix        int32
+	Count         int32
+	PerfOffset    int32
+	PerfsPerFrame int32
+	PerfsPerCount int32
+}
+
+// Chromaticities holds the CIE xy coordinates of the primaries and the
+// white point of an RGB color space.
+type Chromaticities struct {
+	Red   V2f
+	Green V2f
+	Blue  V2f
+	White V2f
+}
+
+const (
+	// EnvMapLatLong indicates an environment map that uses a
+	// latitude-longitude projection.
+	EnvMapLatLong EnvMap = 0
+
+	// EnvMapCube indicates an environment map that consists of the six
+	// faces of a cube, stacked vertically.
+	EnvMapCube EnvMap = 1
+)
+
+// EnvMap represents the way in which an image represents an environment
+// map.
+type EnvMap uint8
+
+// String returns the name of the environment map type.
+func (m EnvMap) String() string {
+	switch m {
+	case EnvMapLatLong:
+		return "ENVMAP_LATLONG"
+	case EnvMapCube:
+		return "ENVMAP_CUBE"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", m)
+	}
+}
+
+const (
+	// DeepImageStateMessy indicates deep samples that may be in any order
+	// and may overlap.
+	DeepImageStateMessy DeepImageState = 0
+
+	// DeepImageStateSorted indicates deep samples that are sorted by depth
+	// but may overlap.
+	DeepImageStateSorted DeepImageState = 1
+
+	// DeepImageStateNonOverlapping indicates deep samples that do not
+	// overlap but may be in any order.
+	DeepImageStateNonOverlapping DeepImageState = 2
+
+	// DeepImageStateTidy indicates deep samples that are sorted by depth
+	// and do not overlap.
+	DeepImageStateTidy DeepImageState = 3
+)
+
+// DeepImageState represents the guarantees that a deep image makes about
+// the order and overlap of its samples.
+type DeepImageState uint8
+
+// String returns the name of the deep image state.
+func (s DeepImageState) String() string {
+	switch s {
+	case DeepImageStateMessy:
+		return "MESSY"
+	case DeepImageStateSorted:
+		return "SORTED"
+	case DeepImageStateNonOverlapping:
+		return "NON_OVERLAPPING"
+	case DeepImageStateTidy:
+		return "TIDY"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", s)
+	}
+}
+
+// Attributes holds the attributes of a part of an EXR image by name. It
+// contains both the standard attributes and any custom ones.
+//
+// Each value has the Go type that represents its attribute type:
+//
+//   - int, float and double values are int32, float32 and float64
+//   - string, stringvector and floatvector values are string, []string
+//     and []float32
+//   - box2i values are image.Rectangle and preview values are *image.NRGBA
+//   - chlist values are []Channel
+//   - values of all other types defined by the OpenEXR specification have
+//     the type with the matching name (e.g. M44f for m44f or TimeCode for
+//     timecode)
+//   - values of unknown types, as well as values that cannot be decoded
+//     as their type, are OpaqueAttribute
+type Attributes map[string]any
+
+// AttributeValue returns the value of the attribute with the specified
+// name. The returned bool is false if there is no such attribute or if its
+// value is not of type T.
+func AttributeValue[T any](attributes Attributes, name string) (T, bool) {
+	value, ok := attributes[name].(T)
+	return value, ok
+}
+
+// newAttributes decodes the attributes of a header. Attributes whose values
+// cannot be decoded are kept as OpaqueAttribute values, since a malformed
+// attribute that the decoder does not need should not prevent an image from
+// being decoded.
+func newAttributes(header exr.Header) Attributes {
+	attributes := make(Attributes, len(header.Attributes))
+	for _, attribute := range header.Attributes {
+		value, err := readAttributeValue(attribute)
+		if err != nil {
+			value = OpaqueAttribute{
+				Type: string(attribute.Type),
+				Data: attribute.Value,
+			}
+		}
+		attributes[string(attribute.Name)] = value
+	}
+	return attributes
+}
+
+// OpaqueAttribute holds the value of an attribute whose type is not
+// defined by the OpenEXR specification or whose value is malformed.
+type OpaqueAttribute struct {
+
+	// Type holds the name of the attribute type.
+	Type string
+
+	// Data holds the raw value of the attribute, as it is stored in the
+	// image.
+	Data []byte
+}
+
+// readAttributeValue decodes the value of an attribute into the Go type
+// that represents its attribute type. The values of unknown attribute
+// types are returned as OpaqueAttribute values.
+func readAttributeValue(attribute exr.Attribute) (any, error) {
+	in := bytes.NewReader(attribute.Value)
+	switch attribute.Type {
+	case exr.AttributeTypeInt:
+		return readValue[int32](in)
+	case exr.AttributeTypeFloat:
+		return readValue[float32](in)
+	case exr.AttributeTypeDouble:
+		return readValue[float64](in)
+	case exr.AttributeTypeString:
+		return string(attribute.Value), nil
+	case exr.AttributeTypeStringVector:
+		return readStringVector(in)
+	case exr.AttributeTypeFloatVector:
+		if len(attribute.Value)%4 != 0 {
+			return nil, fmt.Errorf("invalid float vector size %d", len(attribute.Value))
+		}
+		value := make([]float32, len(attribute.Value)/4)
+		return value, exr.Read(in, value)
+	case exr.AttributeTypeV2i:
+		return readValue[V2i](in)
+	case exr.AttributeTypeV2f:
+		return readValue[V2f](in)
+	case exr.AttributeTypeV2d:
+		return readValue[V2d](in)
+	case exr.AttributeTypeV3i:
+		return readValue[V3i](in)
+	case exr.AttributeTypeV3f:
+		return readValue[V3f](in)
+	case exr.AttributeTypeV3d:
+		return readValue[V3d](in)
+	case exr.AttributeTypeBox2i:
+		var value exr.Box2i
+		if err := exr.ReadBox2i(in, &value); err != nil {
+			return nil, err
+		}
+		return boxToRect(value), nil
+	case exr.AttributeTypeBox2f:
+		return readValue[Box2f](in)
+	case exr.AttributeTypeM33f:
+		return readValue[M33f](in)
+	case exr.AttributeTypeM33d:
+		return readValue[M33d](in)
+	case exr.AttributeTypeM44f:
+		return readValue[M44f](in)
+	case exr.AttributeTypeM44d:
+		return readValue[M44d](in)
+	case exr.AttributeTypeRational:
+		return readValue[Rational](in)
+	case exr.AttributeTypeTimeCode:
+		return readValue[TimeCode](in)
+	case exr.AttributeTypeKeyCode:
+		return readValue[KeyCode](in)
+	case exr.AttributeTypeChromaticities:
+		return readValue[Chromaticities](in)
+	case exr.AttributeTypeEnvMap:
+		return readValue[EnvMap](in)
+	case exr.AttributeTypeDeepImageState:
+		return readValue[DeepImageState](in)
+	case exr.AttributeTypePreview:
+		return readPreview(in)
+	case exr.AttributeTypeChannelList:
+		var value exr.ChannelList
+		if err := exr.ReadChannelList(in, &value); err != nil {
+			return nil, err
+		}
+		return newChannels(value), nil
+	case exr.AttributeTypeCompression:
+		return readValue[Compression](in)
+	case exr.AttributeTypeLineOrder:
+		return readValue[LineOrder](in)
+	case exr.AttributeTypeTileDesc:
+		var value exr.TileDescription
+		if err := exr.ReadTileDescription(in, &value); err != nil {
+			return nil, err
+		}
+		return newTileDescription(value), nil
+	default:
+		return OpaqueAttribute{
+			Type: string(attribute.Type),
+			Data: attribute.Value,
+		}, nil
+	}
+}
+
+// readValue reads a fixed size value of type T.
+func readValue[T any](in io.Reader) (T, error) {
+	var value T
+	err := exr.Read(in, &value)
+	return value, err
+}
+
+// readStringVector reads a sequence of strings, each of which is preceded
+// by its size, until the end of in.
+func readStringVector(in *bytes.Reader) ([]string, error) {
+	var result []string
+	for in.Len() > 0 {
+		var size int32
+		if err := exr.Read(in, &size); err != nil {
+			return nil, fmt.Errorf("error reading string size: %w", err)
+		}
+		if size < 0 || int(size) > in.Len() {
+			return nil, fmt.Errorf("invalid string size %d", size)
+		}
+		var value string
+		if err := exr.ReadString(in, int(size), &value); err != nil {
+			return nil, fmt.Errorf("error reading string: %w", err)
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// readPreview reads a preview image, which consists of its dimensions
+// followed by non-premultiplied 8-bit RGBA pixels.
+func readPreview(in *bytes.Reader) (*image.NRGBA, error) {
+	var width, height uint32
+	if err := exr.Read(in, &width); err != nil {
+		return nil, fmt.Errorf("error reading preview width: %w", err)
+	}
+	if err := exr.Read(in, &height); err != nil {
+		return nil, fmt.Errorf("error reading preview height: %w", err)
+	}
+	if uint64(width)*uint64(height)*4 != uint64(in.Len()) {
+		return nil, fmt.Errorf("invalid preview size (%d x %d)", width, height)
+	}
+	preview := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	if _, err := io.ReadFull(in, preview.Pix); err != nil {
+		return nil, fmt.Errorf("error reading preview pixels: %w", err)
+	}
+	return preview, nil
+}
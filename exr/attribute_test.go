@@ -0,0 +1,303 @@
+package exr_test
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestDecodeAttributes(t *testing.T) {
+	preview := image.NewNRGBA(image.Rect(0, 0, 1, 2))
+	copy(preview.Pix, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+
+	testCases := []struct {
+		attribute internal.Attribute
+		want      any
+	}{
+		{
+			attribute: testAttribute(t, "int", internal.AttributeTypeInt, int32(-7)),
+			want:      int32(-7),
+		},
+		{
+			attribute: testAttribute(t, "float", internal.AttributeTypeFloat, float32(1.5)),
+			want:      float32(1.5),
+		},
+		{
+			attribute: testAttribute(t, "double", internal.AttributeTypeDouble, float64(1e100)),
+			want:      float64(1e100),
+		},
+		{
+			attribute: testAttribute(t, "string", internal.AttributeTypeString, []byte("text")),
+			want:      "text",
+		},
+		{
+			attribute: testAttribute(t, "stringvector", internal.AttributeTypeStringVector,
+				int32(1), []byte("a"), int32(0), int32(3), []byte("bcd")),
+			want: []string{"a", "", "bcd"},
+		},
+		{
+			attribute: testAttribute(t, "floatvector", internal.AttributeTypeFloatVector, []float32{1, -2, 0.25}),
+			want:      []float32{1, -2, 0.25},
+		},
+		{
+			attribute: testAttribute(t, "v2i", internal.AttributeTypeV2i, []int32{1, -2}),
+			want:      exr.V2i{X: 1, Y: -2},
+		},
+		{
+			attribute: testAttribute(t, "v2f", internal.AttributeTypeV2f, []float32{1.5, -2.5}),
+			want:      exr.V2f{X: 1.5, Y: -2.5},
+		},
+		{
+			attribute: testAttribute(t, "v2d", internal.AttributeTypeV2d, []float64{1.5, -2.5}),
+			want:      exr.V2d{X: 1.5, Y: -2.5},
+		},
+		{
+			attribute: testAttribute(t, "v3i", internal.AttributeTypeV3i, []int32{1, -2, 3}),
+			want:      exr.V3i{X: 1, Y: -2, Z: 3},
+		},
+		{
+			attribute: testAttribute(t, "v3f", internal.AttributeTypeV3f, []float32{1.5, -2.5, 3.5}),
+			want:      exr.V3f{X: 1.5, Y: -2.5, Z: 3.5},
+		},
+		{
+			attribute: testAttribute(t, "v3d", internal.AttributeTypeV3d, []float64{1.5, -2.5, 3.5}),
+			want:      exr.V3d{X: 1.5, Y: -2.5, Z: 3.5},
+		},
+		{
+			// The maximum point of a box2i is part of the box, unlike the
+			// maximum point of an image.Rectangle.
+			attribute: testAttribute(t, "box2i", internal.AttributeTypeBox2i, []int32{-1, -2, 3, 4}),
+			want:      image.Rect(-1, -2, 4, 5),
+		},
+		{
+			attribute: testAttribute(t, "box2f", internal.AttributeTypeBox2f, []float32{-1, -2, 3, 4}),
+			want:      exr.Box2f{Min: exr.V2f{X: -1, Y: -2}, Max: exr.V2f{X: 3, Y: 4}},
+		},
+		{
+			attribute: testAttribute(t, "m33f", internal.AttributeTypeM33f, []float32{1, 2, 3, 4, 5, 6, 7, 8, 9}),
+			want:      exr.M33f{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}},
+		},
+		{
+			attribute: testAttribute(t, "m33d", internal.AttributeTypeM33d, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9}),
+			want:      exr.M33d{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}},
+		},
+		{
+			attribute: testAttribute(t, "m44f", internal.AttributeTypeM44f,
+				[]float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}),
+			want: exr.M44f{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}, {13, 14, 15, 16}},
+		},
+		{
+			attribute: testAttribute(t, "m44d", internal.AttributeTypeM44d,
+				[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}),
+			want: exr.M44d{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}, {13, 14, 15, 16}},
+		},
+		{
+			attribute: testAttribute(t, "rational", internal.AttributeTypeRational, int32(-30000), uint32(1001)),
+			want:      exr.Rational{Numerator: -30000, Denominator: 1001},
+		},
+		{
+			attribute: testAttribute(t, "timecode", internal.AttributeTypeTimeCode, uint32(0x12345678), uint32(0x9abcdef0)),
+			want:      exr.TimeCode{TimeAndFlags: 0x12345678, UserData: 0x9abcdef0},
+		},
+		{
+			attribute: testAttribute(t, "keycode", internal.AttributeTypeKeyCode, []int32{1, 2, 3, 4, 5, 6, 7}),
+			want: exr.KeyCode{
+				FilmMfcCode:   1,
+				FilmType:      2,
+				Prefix:        3,
+				Count:         4,
+				PerfOffset:    5,
+				PerfsPerFrame: 6,
+				PerfsPerCount: 7,
+			},
+		},
+		{
+			attribute: testAttribute(t, "chromaticities", internal.AttributeTypeChromaticities,
+				[]float32{0.64, 0.33, 0.3, 0.6, 0.15, 0.06, 0.3127, 0.329}),
+			want: exr.Chromaticities{
+				Red:   exr.V2f{X: 0.64, Y: 0.33},
+				Green: exr.V2f{X: 0.3, Y: 0.6},
+				Blue:  exr.V2f{X: 0.15, Y: 0.06},
+				White: exr.V2f{X: 0.3127, Y: 0.329},
+			},
+		},
+		{
+			attribute: testAttribute(t, "envmap", internal.AttributeTypeEnvMap, uint8(1)),
+			want:      exr.EnvMapCube,
+		},
+		{
+			attribute: testAttribute(t, "deepImageState", internal.AttributeTypeDeepImageState, uint8(1)),
+			want:      exr.DeepImageStateSorted,
+		},
+		{
+			attribute: testAttribute(t, "lineOrder", internal.AttributeTypeLineOrder, uint8(2)),
+			want:      exr.LineOrderRandomY,
+		},
+		{
+			attribute: testAttribute(t, "compression", internal.AttributeTypeCompression, uint8(4)),
+			want:      exr.CompressionPIZ,
+		},
+		{
+			// The level mode is held by the low and the rounding mode by the
+			// high four bits of the last byte.
+			attribute: testAttribute(t, "tiledesc", internal.AttributeTypeTileDesc, uint32(64), uint32(32), uint8(0x12)),
+			want: exr.TileDescription{
+				XSize:        64,
+				YSize:        32,
+				LevelMode:    exr.LevelModeRipmap,
+				RoundingMode: exr.RoundingModeUp,
+			},
+		},
+		{
+			attribute: testAttribute(t, "chlist", internal.AttributeTypeChannelList,
+				[]byte("B\x00"), int32(1), uint8(1), [3]uint8{}, int32(2), int32(1),
+				[]byte("Z\x00"), int32(2), uint8(0), [3]uint8{}, int32(1), int32(1),
+				[]byte{0}),
+			want: []exr.Channel{
+				{Name: "B", PixelType: exr.PixelTypeHalf, Linear: true, XSampling: 2, YSampling: 1},
+				{Name: "Z", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+			},
+		},
+		{
+			attribute: testAttribute(t, "preview", internal.AttributeTypePreview, uint32(1), uint32(2), preview.Pix),
+			want:      preview,
+		},
+	}
+
+	window := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 3}
+	img := &testImage{
+		header: newTestHeader(window, window, newTestChannel("R", internal.PixelTypeHalf)),
+	}
+	// The attributes are named after their types, with a prefix that keeps
+	// them apart from the standard attributes of the header.
+	for _, tc := range testCases {
+		attribute := tc.attribute
+		attribute.Name = "value." + attribute.Name
+		img.header.Attributes = append(img.header.Attributes, attribute)
+	}
+
+	header, err := exr.DecodeHeader(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	for _, tc := range testCases {
+		name := "value." + string(tc.attribute.Name)
+		if got := header.Attributes[name]; !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %#v, want %#v", tc.attribute.Type, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeMalformedAttributes(t *testing.T) {
+	// Values that cannot be decoded as their type are kept as they are.
+	attributes := []internal.Attribute{
+		testAttribute(t, "int", internal.AttributeTypeInt, int16(1)),
+		testAttribute(t, "m44f", internal.AttributeTypeM44f, []float32{1, 2, 3}),
+		testAttribute(t, "stringvector", internal.AttributeTypeStringVector, int32(5), []byte("abc")),
+		testAttribute(t, "floatvector", internal.AttributeTypeFloatVector, float32(1), int16(2)),
+		testAttribute(t, "preview", internal.AttributeTypePreview, uint32(2), uint32(2), []byte{1, 2, 3, 4}),
+		testAttribute(t, "chlist", internal.AttributeTypeChannelList, []byte("R")),
+	}
+
+	window := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 3}
+	img := &testImage{
+		header: newTestHeader(window, window, newTestChannel("R", internal.PixelTypeHalf)),
+	}
+	img.header.Attributes = attributes
+
+	header, err := exr.DecodeHeader(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	for _, attribute := range attributes {
+		want := exr.OpaqueAttribute{Type: string(attribute.Type), Data: attribute.Value}
+		if got := header.Attributes[string(attribute.Name)]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", attribute.Name, got, want)
+		}
+	}
+}
+
+func TestDecodeCustomAttributes(t *testing.T) {
+	cameraTransform := exr.M44f{{1, 0, 0, 0}, {0, 0, -1, 0}, {0, 1, 0, 0}, {10, 20, 30, 1}}
+	want := map[string]any{
+		"renderTime":               float32(12.5),
+		"samples":                  int32(256),
+		"cryptomatte/0a1b2c3/name": "CryptoObject",
+		"cameraTransform":          cameraTransform,
+		"lensShift":                exr.V2f{X: 0.25, Y: -0.125},
+		"overscan":                 image.Rect(-8, -8, 12, 9),
+		"renderer/settings":        exr.OpaqueAttribute{Type: "json", Data: []byte(`{"spp":256}`)},
+		"renderer/marker":          exr.OpaqueAttribute{Type: "marker", Data: []byte{}},
+	}
+
+	window := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 0}
+	img := &testImage{
+		header: newTestHeader(window, window, newTestChannel("R", internal.PixelTypeFloat)),
+	}
+	img.header.Attributes = []internal.Attribute{
+		testAttribute(t, "renderTime", internal.AttributeTypeFloat, float32(12.5)),
+		testAttribute(t, "samples", internal.AttributeTypeInt, int32(256)),
+		testAttribute(t, "cryptomatte/0a1b2c3/name", internal.AttributeTypeString, []byte("CryptoObject")),
+		testAttribute(t, "cameraTransform", internal.AttributeTypeM44f, cameraTransform),
+		testAttribute(t, "lensShift", internal.AttributeTypeV2f, exr.V2f{X: 0.25, Y: -0.125}),
+		testAttribute(t, "overscan", internal.AttributeTypeBox2i, internal.Box2i{XMin: -8, YMin: -8, XMax: 11, YMax: 8}),
+		testAttribute(t, "renderer/settings", "json", []byte(`{"spp":256}`)),
+		testAttribute(t, "renderer/marker", "marker"),
+	}
+	img.chunks = []testChunk{{data: scanLineChunk(t, 0, blockData(img.header.Channels, window,
+		func(channel int, x, y int32) float32 { return float32(x) }))}}
+	data := img.bytes(t)
+
+	decoded, err := exr.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	header, err := exr.DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	sources := map[string]exr.Attributes{
+		"image":  decoded.(*exr.RGBAImage).Attributes(),
+		"header": header.Attributes,
+	}
+	for source, attributes := range sources {
+		for name, value := range want {
+			if got := attributes[name]; !reflect.DeepEqual(got, value) {
+				t.Fatalf("%s: %s: got %#v, want %#v", source, name, got, value)
+			}
+		}
+	}
+
+	attributes := header.Attributes
+	if value, ok := exr.AttributeValue[int32](attributes, "samples"); !ok || value != 256 {
+		t.Fatalf("got samples %v (%t), want 256", value, ok)
+	}
+	if value, ok := exr.AttributeValue[exr.M44f](attributes, "cameraTransform"); !ok || value != cameraTransform {
+		t.Fatalf("got camera transform %v (%t), want %v", value, ok, cameraTransform)
+	}
+	if value, ok := exr.AttributeValue[exr.OpaqueAttribute](attributes, "renderer/settings"); !ok || value.Type != "json" {
+		t.Fatalf("got settings %v (%t), want an opaque json attribute", value, ok)
+	}
+
+	// Values of a different type, as well as missing attributes, result
+	// in the zero value.
+	if value, ok := exr.AttributeValue[float32](attributes, "samples"); ok || value != 0 {
+		t.Fatalf("got samples as float %v (%t), want a type mismatch", value, ok)
+	}
+	if value, ok := exr.AttributeValue[int](attributes, "samples"); ok || value != 0 {
+		t.Fatalf("got samples as int %v (%t), want a type mismatch", value, ok)
+	}
+	if value, ok := exr.AttributeValue[exr.M44d](attributes, "cameraTransform"); ok || value != (exr.M44d{}) {
+		t.Fatalf("got camera transform as M44d %v (%t), want a type mismatch", value, ok)
+	}
+	if value, ok := exr.AttributeValue[string](attributes, "renderer/settings"); ok || value != "" {
+		t.Fatalf("got settings as string %q (%t), want a type mismatch", value, ok)
+	}
+	if value, ok := exr.AttributeValue[string](attributes, "missing"); ok || value != "" {
+		t.Fatalf("got missing attribute %q (%t)", value, ok)
+	}
+}
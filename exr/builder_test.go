@@ -0,0 +1,319 @@
+package exr_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/x448/float16"
+
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// testImage describes an EXR image that a test assembles chunk by chunk,
+// so that the decoder can be tested on layouts that the encoder does not
+// produce.
+type testImage struct {
+	version internal.Version
+	header  internal.Header
+	chunks  []testChunk
+}
+
+// testChunk holds a chunk of a testImage, which is referenced by the
+// specified index of the offset table. The chunks are stored in the order
+// in which they are listed, regardless of their index.
+type testChunk struct {
+	index int
+	data  []byte
+}
+
+// testMultipartImage describes a multipart EXR image that a test assembles
+// chunk by chunk. The chunks of the different parts can be interleaved.
+type testMultipartImage struct {
+	headers []internal.Header
+	chunks  []testPartChunk
+}
+
+// testPartChunk holds a chunk of the specified part of a testMultipartImage.
+type testPartChunk struct {
+	part int
+	testChunk
+}
+
+// newTestHeader returns the header of a scan line image with the specified
+// windows and channels that uses no compression.
+func newTestHeader(dataWindow, displayWindow internal.Box2i, channels ...internal.Channel) internal.Header {
+	return internal.Header{
+		Channels:      channels,
+		Compression:   internal.CompressionNone,
+		DataWindow:    dataWindow,
+		DisplayWindow: displayWindow,
+		LineOrder:     internal.LineOrderIncreasingY,
+		Type:          internal.PartTypeScanLine,
+	}
+}
+
+// newTestChannel returns a channel with the specified name and pixel type
+// that is not subsampled.
+func newTestChannel(name string, pixelType internal.PixelType) internal.Channel {
+	return internal.Channel{
+		Name:      name,
+		PixelType: pixelType,
+		XSampling: 1,
+		YSampling: 1,
+	}
+}
+
+// bytes returns the encoded image.
+func (i *testImage) bytes(t *testing.T) []byte {
+	t.Helper()
+
+	version := i.version
+	if version == 0 {
+		version = internal.Version(internal.SupportedVersion)
+		if i.header.Type.IsTiled() {
+			version |= internal.Version(internal.FlagSingleTile)
+		}
+		if i.header.Type.IsDeep() {
+			version |= internal.Version(internal.FlagNonImage)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := internal.WriteMagic(out, internal.MagicSequence); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.WriteVersion(out, version); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.WriteHeader(out, i.header); err != nil {
+		t.Fatal(err)
+	}
+
+	offsets := make([]uint64, 0, len(i.chunks))
+	for _, chunk := range i.chunks {
+		for len(offsets) <= chunk.index {
+			offsets = append(offsets, 0)
+		}
+	}
+	offset := uint64(out.Len() + 8*len(offsets))
+	for _, chunk := range i.chunks {
+		offsets[chunk.index] = offset
+		offset += uint64(len(chunk.data))
+	}
+	if err := internal.WriteOffsets(out, offsets); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range i.chunks {
+		out.Write(chunk.data)
+	}
+	return out.Bytes()
+}
+
+// bytes returns the encoded image. The offset table of each part has as
+// many entries as the chunk count of its header specifies.
+func (i *testMultipartImage) bytes(t *testing.T) []byte {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	if err := internal.WriteMagic(out, internal.MagicSequence); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.WriteVersion(out, internal.Version(internal.SupportedVersion)|internal.Version(internal.FlagMultipart)); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.WriteHeaders(out, i.headers); err != nil {
+		t.Fatal(err)
+	}
+
+	offsets := make([][]uint64, len(i.headers))
+	tableSize := 0
+	for part, header := range i.headers {
+		offsets[part] = make([]uint64, header.ChunkCount)
+		tableSize += 8 * int(header.ChunkCount)
+	}
+	offset := uint64(out.Len() + tableSize)
+	for _, chunk := range i.chunks {
+		offsets[chunk.part][chunk.index] = offset
+		offset += uint64(4 + len(chunk.data))
+	}
+	for _, partOffsets := range offsets {
+		if err := internal.WriteOffsets(out, partOffsets); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, chunk := range i.chunks {
+		if err := internal.WritePartNumber(out, int32(chunk.part)); err != nil {
+			t.Fatal(err)
+		}
+		out.Write(chunk.data)
+	}
+	return out.Bytes()
+}
+
+// scanLineChunk returns a scan line chunk that starts at line y.
+func scanLineChunk(t *testing.T, y int32, data []byte) []byte {
+	t.Helper()
+	out := &bytes.Buffer{}
+	if err := internal.WriteScanLineChunk(out, internal.ScanLineChunk{Y: y, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// tileChunk returns a tile chunk with the specified coordinates.
+func tileChunk(t *testing.T, coordinates internal.TileCoordinates, data []byte) []byte {
+	t.Helper()
+	out := &bytes.Buffer{}
+	if err := internal.WriteTileChunk(out, internal.TileChunk{TileCoordinates: coordinates, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// addTiles adds the tiles of all levels of a tiled image in the order in
+// which they are listed in the offset table, where value returns the value
+// of the channel with the specified index at the specified pixel of the
+// specified level.
+func (i *testImage) addTiles(t *testing.T, value func(level internal.Level, channel int, x, y int32) float32) {
+	t.Helper()
+	dataWindow := i.header.DataWindow
+	tiles := i.header.Tiles
+	for _, level := range tiles.Levels(dataWindow) {
+		levelWindow := tiles.LevelWindow(dataWindow, level)
+		levelValue := func(channel int, x, y int32) float32 {
+			return value(level, channel, x, y)
+		}
+		for tileY := 0; tileY < tiles.TileCountY(levelWindow); tileY++ {
+			for tileX := 0; tileX < tiles.TileCountX(levelWindow); tileX++ {
+				coordinates := internal.TileCoordinates{
+					X:      int32(tileX),
+					Y:      int32(tileY),
+					LevelX: int32(level.X),
+					LevelY: int32(level.Y),
+				}
+				block := tiles.TileWindow(levelWindow, coordinates.X, coordinates.Y)
+				i.chunks = append(i.chunks, testChunk{
+					index: len(i.chunks),
+					data:  tileChunk(t, coordinates, blockData(i.header.Channels, block, levelValue)),
+				})
+			}
+		}
+	}
+}
+
+// blockData returns the uncompressed pixel data of the specified block,
+// where value returns the value of the channel with the specified index at
+// the specified pixel.
+func blockData(channels internal.ChannelList, block internal.Box2i, value func(channel int, x, y int32) float32) []byte {
+	out := &bytes.Buffer{}
+	for y := block.YMin; y <= block.YMax; y++ {
+		for c, channel := range channels {
+			if internal.Mod(y, channel.YSampling) != 0 {
+				continue
+			}
+			for x := block.XMin; x <= block.XMax; x++ {
+				if internal.Mod(x, channel.XSampling) != 0 {
+					continue
+				}
+				v := value(c, x, y)
+				switch channel.PixelType {
+				case internal.PixelTypeUint:
+					internal.Write(out, uint32(v))
+				case internal.PixelTypeHalf:
+					internal.Write(out, float16.Fromfloat32(v).Bits())
+				default:
+					internal.Write(out, v)
+				}
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// deepBlockData returns the uncompressed sample count table and sample
+// data of the specified block, where count returns the number of samples of
+// the specified pixel and value returns the value of the channel with the
+// specified index for the specified sample.
+func deepBlockData(channels internal.ChannelList, block internal.Box2i, count func(x, y int32) int, value func(channel int, x, y int32, sample int) float32) ([]byte, []byte) {
+	table := &bytes.Buffer{}
+	for y := block.YMin; y <= block.YMax; y++ {
+		total := 0
+		for x := block.XMin; x <= block.XMax; x++ {
+			total += count(x, y)
+			internal.Write(table, int32(total))
+		}
+	}
+
+	data := &bytes.Buffer{}
+	for y := block.YMin; y <= block.YMax; y++ {
+		for c, channel := range channels {
+			for x := block.XMin; x <= block.XMax; x++ {
+				for sample := 0; sample < count(x, y); sample++ {
+					v := value(c, x, y, sample)
+					switch channel.PixelType {
+					case internal.PixelTypeUint:
+						internal.Write(data, uint32(v))
+					case internal.PixelTypeHalf:
+						internal.Write(data, float16.Fromfloat32(v).Bits())
+					default:
+						internal.Write(data, v)
+					}
+				}
+			}
+		}
+	}
+	return table.Bytes(), data.Bytes()
+}
+
+// deepChunkData returns the sizes, the sample count table and the sample
+// data of a deep chunk, where table and data are stored as specified and
+// unpackedSize is the size of the uncompressed sample data.
+func deepChunkData(table, data []byte, unpackedSize int) []byte {
+	out := &bytes.Buffer{}
+	internal.Write(out, uint64(len(table)))
+	internal.Write(out, uint64(len(data)))
+	internal.Write(out, uint64(unpackedSize))
+	out.Write(table)
+	out.Write(data)
+	return out.Bytes()
+}
+
+// deepScanLineChunk returns a deep scan line chunk that starts at line y,
+// where data is returned by deepChunkData.
+func deepScanLineChunk(y int32, data []byte) []byte {
+	out := &bytes.Buffer{}
+	internal.Write(out, y)
+	out.Write(data)
+	return out.Bytes()
+}
+
+// deepTileChunk returns a deep tile chunk with the specified coordinates,
+// where data is returned by deepChunkData.
+func deepTileChunk(coordinates internal.TileCoordinates, data []byte) []byte {
+	out := &bytes.Buffer{}
+	internal.Write(out, coordinates)
+	out.Write(data)
+	return out.Bytes()
+}
+
+// testAttribute returns an attribute of the specified type whose value
+// consists of the binary encodings of values, one after the other.
+func testAttribute(t *testing.T, name string, attributeType internal.AttributeType, values ...any) internal.Attribute {
+	t.Helper()
+	out := &bytes.Buffer{}
+	for _, value := range values {
+		if err := internal.Write(out, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return internal.Attribute{
+		Name:  internal.AttributeName(name),
+		Type:  attributeType,
+		Value: out.Bytes(),
+	}
+}
+
+// half returns value rounded to the nearest half value.
+func half(value float32) float32 {
+	return float16.Fromfloat32(value).Float32()
+}
@@ -0,0 +1,51 @@
+package exr
+
+import "github.com/mokiat/goexr/exr/internal/exr"
+
+const (
+	// CompressionNone indicates pixel data that is not compressed.
+	CompressionNone Compression = Compression(exr.CompressionNone)
+
+	// CompressionRLE indicates run-length encoded pixel data.
+	CompressionRLE Compression = Compression(exr.CompressionRLE)
+
+	// CompressionZIPS indicates zlib compressed pixel data, with one scan
+	// line per block.
+	CompressionZIPS Compression = Compression(exr.CompressionZIPS)
+
+	// CompressionZIP indicates zlib compressed pixel data, with 16 scan
+	// lines per block.
+	CompressionZIP Compression = Compression(exr.CompressionZIP)
+
+	// CompressionPIZ indicates wavelet and Huffman compressed pixel data.
+	CompressionPIZ Compression = Compression(exr.CompressionPIZ)
+
+	// CompressionPXR24 indicates pixel data where 32-bit floats are
+	// rounded to 24 bits before being zlib compressed.
+	CompressionPXR24 Compression = Compression(exr.CompressionPXR24)
+
+	// CompressionB44 indicates pixel data where half values are
+	// compressed in fixed size 4x4 blocks.
+	CompressionB44 Compression = Compression(exr.CompressionB44)
+
+	// CompressionB44A indicates B44 compressed pixel data, where uniform
+	// 4x4 blocks are stored more compactly.
+	CompressionB44A Compression = Compression(exr.CompressionB44A)
+
+	// CompressionDWAA indicates DCT compressed pixel data, with 32 scan
+	// lines per block.
+	CompressionDWAA Compression = Compression(exr.CompressionDWAA)
+
+	// CompressionDWAB indicates DCT compressed pixel data, with 256 scan
+	// lines per block.
+	CompressionDWAB Compression = Compression(exr.CompressionDWAB)
+)
+
+// Compression represents the way in which the pixel data of an image is
+// compressed.
+type Compression uint8
+
+// String returns the name of the compression.
+func (c Compression) String() string {
+	return exr.Compression(c).String()
+}
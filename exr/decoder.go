@@ -17,153 +17,476 @@ func init() {
 //
 // This function supports all version 2 EXR images.
 func DecodeConfig(in io.Reader) (image.Config, error) {
-	var magic exr.Magic
-	if err := exr.ReadMagic(in, &magic); err != nil {
-		return image.Config{}, fmt.Errorf("error reading magic: %w", err)
-	}
-	if !magic.IsCorrect() {
-		return image.Config{}, fmt.Errorf("incorrect magic sequence \"0x%x\"", magic)
+	_, headers, err := readHeaders(in)
+	if err != nil {
+		return image.Config{}, err
 	}
+	header := headers[0]
 
-	var version exr.Version
-	if err := exr.ReadVersion(in, &version); err != nil {
-		return image.Config{}, fmt.Errorf("error reading version: %w", err)
-	}
-	if version.Number() != exr.SupportedVersion {
-		return image.Config{}, fmt.Errorf("unsupported version %d", version.Number())
-	}
-
-	var header exr.Header
-	if err := exr.ReadHeader(in, &header); err != nil {
-		return image.Config{}, fmt.Errorf("error reading header: %w", err)
+	displayWindow := header.DisplayWindow
+	if displayWindow.Width() <= 0 || displayWindow.Height() <= 0 {
+		return image.Config{}, fmt.Errorf("invalid display window size (%d x %d)", displayWindow.Width(), displayWindow.Height())
 	}
 
 	return image.Config{
 		ColorModel: RGBAModel,
-		Width:      int(header.DisplayWindow.Width()),
-		Height:     int(header.DisplayWindow.Height()),
+		Width:      int(displayWindow.Width()),
+		Height:     int(displayWindow.Height()),
 	}, nil
 }
 
 // Decode reads an EXR image from in and returns it as an image.Image.
-// The type of the Image is RGBAImage.
+// The type of the Image is RGBAImage. The bounds of the image are the part
+// of the display window that is covered by the data window.
 //
 // Only a limited set of EXR image types are supported at the moment.
 // The main restrictions are as follows, though others apply as well:
 //
-// 	- They have to be single-part scan line images.
-// 	- They have to use no compression or zip compression.
+// 	- They have to be scan line or tiled images. For tiled images only
+// 	  the highest resolution level is decoded (see DecodeLevel) and for
+// 	  multipart images only the first part is decoded (see DecodePart).
+// 	- They have to use no compression, RLE, zip (ZIPS / ZIP), PIZ, PXR24,
+// 	  B44 (B44 / B44A) or DWA (DWAA / DWAB) compression.
 func Decode(in io.Reader) (image.Image, error) {
+	return DecodeWithOptions(in, nil)
+}
+
+// DecodeOptions holds settings that control how an image is decoded.
+type DecodeOptions struct {
+
+	// Workers holds the maximum number of chunks that are decompressed
+	// concurrently. Chunks are decompressed one after another, on the
+	// calling goroutine, if it is less than two.
+	Workers int
+}
+
+// DecodeWithOptions reads an EXR image from in, like Decode, using the
+// specified options. Default options are used if opts is nil.
+func DecodeWithOptions(in io.Reader, opts *DecodeOptions) (image.Image, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	version, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	return decodePart(in, version, headers, 0, exr.Level{}, opts.Workers)
+}
+
+// readHeaders reads the magic, version and headers of an EXR image.
+//
+// Single-part images always have a single header, which is assigned a
+// type based on the version flags, if it does not specify one itself.
+func readHeaders(in io.Reader) (exr.Version, []exr.Header, error) {
 	var magic exr.Magic
 	if err := exr.ReadMagic(in, &magic); err != nil {
-		return nil, fmt.Errorf("error reading magic: %w", err)
+		return 0, nil, fmt.Errorf("error reading magic: %w", err)
 	}
 	if !magic.IsCorrect() {
-		return nil, fmt.Errorf("incorrect magic sequence \"0x%x\"", magic)
+		return 0, nil, fmt.Errorf("incorrect magic sequence \"0x%x\"", magic)
 	}
 
 	var version exr.Version
 	if err := exr.ReadVersion(in, &version); err != nil {
-		return nil, fmt.Errorf("error reading version: %w", err)
+		return 0, nil, fmt.Errorf("error reading version: %w", err)
 	}
 	if version.Number() != exr.SupportedVersion {
-		return nil, fmt.Errorf("unsupported version %d", version.Number())
+		return 0, nil, fmt.Errorf("unsupported version %d", version.Number())
+	}
+
+	var headers []exr.Header
+	if version.HasFlag(exr.FlagMultipart) {
+		if err := exr.ReadHeaders(in, &headers); err != nil {
+			return 0, nil, fmt.Errorf("error reading headers: %w", err)
+		}
+		if len(headers) == 0 {
+			return 0, nil, fmt.Errorf("multipart image has no parts")
+		}
+		for i, header := range headers {
+			if header.Name == "" {
+				return 0, nil, fmt.Errorf("part %d has no name", i)
+			}
+			if header.Type == "" {
+				return 0, nil, fmt.Errorf("part %q has no type", header.Name)
+			}
+			if header.ChunkCount < 0 {
+				return 0, nil, fmt.Errorf("part %q has invalid chunk count %d", header.Name, header.ChunkCount)
+			}
+		}
+	} else {
+		var header exr.Header
+		if err := exr.ReadHeader(in, &header); err != nil {
+			return 0, nil, fmt.Errorf("error reading header: %w", err)
+		}
+		if header.Type == "" {
+			header.Type = exr.VersionPartType(version)
+		}
+		headers = append(headers, header)
+	}
+
+	for _, header := range headers {
+		if !header.Compression.IsKnown() {
+			return 0, nil, &UnknownCompressionError{ID: uint8(header.Compression)}
+		}
 	}
-	if version.HasFlag(exr.FlagSingleTile) {
-		return nil, fmt.Errorf("tiled format not supported")
+	return version, headers, nil
+}
+
+// chunkDecoder reads a single chunk from in. It returns a task that decodes
+// the chunk into the image that is being decoded, or nil if the chunk is not
+// needed. A chunk decoder rejects chunks whose block it has already seen, so
+// the tasks of different chunks never write the same pixels and can be run
+// concurrently.
+type chunkDecoder func(in io.Reader) (chunkTask, error)
+
+// decodePart decodes the specified level of the specified part. It expects
+// that in is positioned right after the headers of the image.
+func decodePart(in io.Reader, version exr.Version, headers []exr.Header, part int, level exr.Level, workers int) (*RGBAImage, error) {
+	header := headers[part]
+
+	var (
+		img         *RGBAImage
+		decodeChunk chunkDecoder
+		err         error
+	)
+	switch header.Type {
+	case exr.PartTypeScanLine:
+		if level != (exr.Level{}) {
+			return nil, fmt.Errorf("level (%d, %d) not found", level.X, level.Y)
+		}
+		img, decodeChunk, err = newScanLineDecoder(header, header.DataWindow)
+	case exr.PartTypeTiled:
+		img, decodeChunk, err = newTiledDecoder(header, level, header.DataWindow)
+	case exr.PartTypeDeepScanLine, exr.PartTypeDeepTiled:
+		return nil, fmt.Errorf("deep data not supported (see DecodeDeep)")
+	default:
+		return nil, fmt.Errorf("unsupported part type %q", header.Type)
 	}
-	if version.HasFlag(exr.FlagNonImage) {
-		return nil, fmt.Errorf("deep data not supported")
+	if err != nil {
+		return nil, err
 	}
-	if version.HasFlag(exr.FlagMultipart) {
-		return nil, fmt.Errorf("multipart not supported")
+	img.attributes = newAttributes(header)
+
+	if err := readPartChunks(in, version, headers, part, decodeChunk, workers); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// readPartChunks reads the offsets and chunks of an image, passing the
+// chunks of the specified part to decodeChunk and skipping all others. It
+// expects that in is positioned right after the headers of the image.
+//
+// The chunks are read in order, though up to the specified number of
+// workers can be used to decode them.
+func readPartChunks(in io.Reader, version exr.Version, headers []exr.Header, part int, decodeChunk chunkDecoder, workers int) error {
+	offsets, err := readOffsets(in, version, headers)
+	if err != nil {
+		return err
 	}
+	multipart := version.HasFlag(exr.FlagMultipart)
 
-	var header exr.Header
-	if err := exr.ReadHeader(in, &header); err != nil {
-		return nil, fmt.Errorf("error reading header: %w", err)
+	runner := newChunkRunner(workers)
+	readChunks := func() error {
+		// The chunks of the different parts can be interleaved, so the
+		// ones that belong to other parts need to be skipped.
+		for remaining := len(offsets[part]); remaining > 0 && runner.Err() == nil; {
+			var partNumber int32
+			if multipart {
+				if err := exr.ReadPartNumber(in, len(headers), &partNumber); err != nil {
+					return fmt.Errorf("error reading chunk: %w", err)
+				}
+			}
+			if int(partNumber) != part {
+				if err := exr.SkipChunk(in, headers[partNumber].Type); err != nil {
+					return fmt.Errorf("error skipping chunk: %w", err)
+				}
+				continue
+			}
+			task, err := decodeChunk(in)
+			if err != nil {
+				return err
+			}
+			runner.Run(task)
+			remaining--
+		}
+		return nil
 	}
+	err = readChunks()
+	if waitErr := runner.Wait(); err == nil {
+		err = waitErr
+	}
+	return err
+}
 
+// readOffsets reads the offset tables of all parts of an image. It expects
+// that in is positioned right after the headers of the image.
+func readOffsets(in io.Reader, version exr.Version, headers []exr.Header) ([][]uint64, error) {
+	offsets := make([][]uint64, len(headers))
+	for i, header := range headers {
+		count := int(header.ChunkCount)
+		if !version.HasFlag(exr.FlagMultipart) {
+			var err error
+			if count, err = chunkCount(header); err != nil {
+				return nil, fmt.Errorf("error calculating chunk count: %w", err)
+			}
+		}
+		if err := exr.ReadOffsets(in, count, &offsets[i]); err != nil {
+			return nil, fmt.Errorf("error reading offsets: %w", err)
+		}
+	}
+	return offsets, nil
+}
+
+// chunkCount returns the number of chunks of a single-part image. The data
+// window and the tile description are validated first, since the count is
+// derived from them.
+func chunkCount(header exr.Header) (int, error) {
 	dataWindow := header.DataWindow
 	if dataWindow.Width() <= 0 || dataWindow.Height() <= 0 {
-		return nil, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+		return 0, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+	}
+	if header.Type.IsTiled() {
+		if err := header.Tiles.Validate(); err != nil {
+			return 0, fmt.Errorf("invalid tiles: %w", err)
+		}
+		return header.Tiles.ChunkCount(dataWindow), nil
+	}
+	return exr.ChunkCount(dataWindow, header.Compression)
+}
+
+// newScanLineDecoder creates an RGBAImage that covers the specified region
+// of a scan line part, along with a chunkDecoder that fills it. Chunks that
+// do not overlap the region are skipped.
+func newScanLineDecoder(header exr.Header, region exr.Box2i) (*RGBAImage, chunkDecoder, error) {
+	dataWindow := header.DataWindow
+	if dataWindow.Width() <= 0 || dataWindow.Height() <= 0 {
+		return nil, nil, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+	}
+	if err := header.LineOrder.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid line order: %w", err)
 	}
 
 	displayWindow := header.DisplayWindow
-	if !dataWindow.Contains(displayWindow) {
-		return nil, fmt.Errorf("invalid display window: not contained by data window")
+
+	decompressor, err := newDecompressor(header)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	lineOrder := header.LineOrder
-	if lineOrder != exr.LineOrderIncreasingY {
-		return nil, fmt.Errorf("unsupported line order %q", lineOrder)
+	region = region.Intersect(dataWindow)
+	if region.IsEmpty() {
+		return nil, nil, fmt.Errorf("region outside of data window")
 	}
 
-	var (
-		decompressor exr.Decompressor
-	)
+	rect := boxToRect(displayWindow).Intersect(boxToRect(region))
+	img, dataChannels, err := newRGBAImage(header.Channels, dataWindow, region, rect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[int32]bool)
+	decodeChunk := func(in io.Reader) (chunkTask, error) {
+		var chunk exr.ScanLineChunk
+		if err := exr.ReadScanLineChunk(in, &chunk); err != nil {
+			return nil, fmt.Errorf("error reading scan line chunk: %w", err)
+		}
+		block, err := exr.ScanLineBlock(dataWindow, header.Compression, chunk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan line chunk: %w", err)
+		}
+		if seen[chunk.Y] {
+			return nil, fmt.Errorf("duplicate scan line chunk at line %d", chunk.Y)
+		}
+		seen[chunk.Y] = true
+		if block.Intersect(region).IsEmpty() {
+			return nil, nil
+		}
+		return func() error {
+			if err := readBlock(chunk.Data, block, header.Channels, decompressor, dataChannels); err != nil {
+				return fmt.Errorf("error reading scan line block: %w", err)
+			}
+			return nil
+		}, nil
+	}
+	return img, decodeChunk, nil
+}
+
+// newTiledDecoder creates an RGBAImage that covers the specified region of
+// a level of a tiled part, along with a chunkDecoder that fills it. Chunks
+// that do not overlap the region are skipped.
+func newTiledDecoder(header exr.Header, level exr.Level, region exr.Box2i) (*RGBAImage, chunkDecoder, error) {
+	dataWindow := header.DataWindow
+	if dataWindow.Width() <= 0 || dataWindow.Height() <= 0 {
+		return nil, nil, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+	}
+	if err := header.LineOrder.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid line order: %w", err)
+	}
+
+	displayWindow := header.DisplayWindow
 
-	compression := header.Compression
-	switch compression {
+	tiles := header.Tiles
+	if err := tiles.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid tiles: %w", err)
+	}
+	if !tiles.HasLevel(dataWindow, level) {
+		return nil, nil, fmt.Errorf("level (%d, %d) not found", level.X, level.Y)
+	}
+	for _, channel := range header.Channels {
+		if channel.XSampling != 1 || channel.YSampling != 1 {
+			return nil, nil, fmt.Errorf("invalid channel %q: tiled images cannot be subsampled", channel.Name)
+		}
+	}
+
+	decompressor, err := newDecompressor(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	levelWindow := tiles.LevelWindow(dataWindow, level)
+	region = region.Intersect(levelWindow)
+	if region.IsEmpty() {
+		return nil, nil, fmt.Errorf("region outside of level window")
+	}
+
+	rect := boxToRect(levelWindow)
+	if level == (exr.Level{}) {
+		rect = boxToRect(displayWindow)
+	}
+	rect = rect.Intersect(boxToRect(region))
+	img, dataChannels, err := newRGBAImage(header.Channels, levelWindow, region, rect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[exr.TileCoordinates]bool)
+	decodeChunk := func(in io.Reader) (chunkTask, error) {
+		var chunk exr.TileChunk
+		if err := exr.ReadTileChunk(in, &chunk); err != nil {
+			return nil, fmt.Errorf("error reading tile chunk: %w", err)
+		}
+		if chunk.Level() != level {
+			return nil, nil
+		}
+		block, err := tileBlock(tiles, levelWindow, chunk.TileCoordinates)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tile chunk: %w", err)
+		}
+		if seen[chunk.TileCoordinates] {
+			return nil, fmt.Errorf("duplicate tile chunk (%d, %d)", chunk.X, chunk.Y)
+		}
+		seen[chunk.TileCoordinates] = true
+		if block.Intersect(region).IsEmpty() {
+			return nil, nil
+		}
+		return func() error {
+			if err := readBlock(chunk.Data, block, header.Channels, decompressor, dataChannels); err != nil {
+				return fmt.Errorf("error reading tile block: %w", err)
+			}
+			return nil
+		}, nil
+	}
+	return img, decodeChunk, nil
+}
+
+// tileBlock returns the window that is covered by the tile with the
+// specified coordinates, within a level with the specified window.
+func tileBlock(tiles exr.TileDescription, levelWindow exr.Box2i, coordinates exr.TileCoordinates) (exr.Box2i, error) {
+	if coordinates.X < 0 || int(coordinates.X) >= tiles.TileCountX(levelWindow) ||
+		coordinates.Y < 0 || int(coordinates.Y) >= tiles.TileCountY(levelWindow) {
+		return exr.Box2i{}, fmt.Errorf("tile (%d, %d) outside of level", coordinates.X, coordinates.Y)
+	}
+	return tiles.TileWindow(levelWindow, coordinates.X, coordinates.Y), nil
+}
+
+func newDecompressor(header exr.Header) (exr.Decompressor, error) {
+	switch compression := header.Compression; compression {
 	case exr.CompressionNone:
-		decompressor = exr.NewNopDecompressor()
-	case exr.CompressionZIP:
-		decompressor = exr.NewZipDecompressor()
+		return exr.NewNopDecompressor(), nil
+	case exr.CompressionRLE:
+		return exr.NewRLEDecompressor(), nil
+	case exr.CompressionZIPS, exr.CompressionZIP:
+		return exr.NewZipDecompressor(), nil
+	case exr.CompressionPIZ:
+		return exr.NewPizDecompressor(header.Channels), nil
+	case exr.CompressionPXR24:
+		return exr.NewPxr24Decompressor(header.Channels), nil
+	case exr.CompressionB44, exr.CompressionB44A:
+		return exr.NewB44Decompressor(header.Channels), nil
+	case exr.CompressionDWAA, exr.CompressionDWAB:
+		return exr.NewDwaDecompressor(header.Channels), nil
 	default:
 		return nil, fmt.Errorf("unsupported compression %q", compression)
 	}
+}
 
-	var (
-		dataChannelR = exr.NewNopPixelData(0.0)
-		dataChannelG = exr.NewNopPixelData(0.0)
-		dataChannelB = exr.NewNopPixelData(0.0)
-		dataChannelA = exr.NewNopPixelData(1.0)
-	)
+// newRGBAImage creates an RGBAImage with the specified bounds, along with
+// the pixel data of each channel, which covers the specified region of the
+// data window.
+func newRGBAImage(channels exr.ChannelList, dataWindow, region exr.Box2i, rect image.Rectangle) (*RGBAImage, []exr.PixelData, error) {
+	img := &RGBAImage{
+		rect:     rect,
+		channelR: exr.NewNopPixelData(0.0),
+		channelG: exr.NewNopPixelData(0.0),
+		channelB: exr.NewNopPixelData(0.0),
+		channelA: exr.NewNopPixelData(1.0),
+	}
 
-	dataChannels := make([]exr.PixelData, len(header.Channels))
-	for i, channel := range header.Channels {
+	dataChannels := make([]exr.PixelData, len(channels))
+	for i, channel := range channels {
+		if err := validateSampling(channel, dataWindow); err != nil {
+			return nil, nil, fmt.Errorf("invalid channel %q: %w", channel.Name, err)
+		}
+		window := exr.SamplingWindow(region, channel.XSampling, channel.YSampling)
 		switch channel.PixelType {
 		case exr.PixelTypeUint:
-			dataChannels[i] = exr.NewUint32PixelData(dataWindow, channel.XSampling, channel.YSampling)
+			dataChannels[i] = exr.NewUint32PixelData(window, channel.XSampling, channel.YSampling)
 		case exr.PixelTypeHalf:
-			dataChannels[i] = exr.NewFloat16PixelData(dataWindow, channel.XSampling, channel.YSampling)
+			dataChannels[i] = exr.NewFloat16PixelData(window, channel.XSampling, channel.YSampling)
 		case exr.PixelTypeFloat:
-			dataChannels[i] = exr.NewFloat32PixelData(dataWindow, channel.XSampling, channel.YSampling)
+			dataChannels[i] = exr.NewFloat32PixelData(window, channel.XSampling, channel.YSampling)
 		default:
-			return nil, fmt.Errorf("unsupported channel pixel type %q", channel.PixelType)
+			return nil, nil, fmt.Errorf("unsupported channel pixel type %q", channel.PixelType)
 		}
 		switch channel.Name {
 		case "R":
-			dataChannelR = dataChannels[i]
+			img.channelR = dataChannels[i]
 		case "G":
-			dataChannelG = dataChannels[i]
+			img.channelG = dataChannels[i]
 		case "B":
-			dataChannelB = dataChannels[i]
+			img.channelB = dataChannels[i]
 		case "A":
-			dataChannelA = dataChannels[i]
+			img.channelA = dataChannels[i]
 		}
 	}
+	return img, dataChannels, nil
+}
 
-	chunkCount := exr.ChunkCount(dataWindow, compression)
-
-	if err := exr.ReadOffsets(in, chunkCount); err != nil {
-		return nil, fmt.Errorf("error reading offsets: %w", err)
+func readBlock(data []byte, block exr.Box2i, channels exr.ChannelList, decompressor exr.Decompressor, dataChannels []exr.PixelData) error {
+	buffer, err := exr.DecompressBlock(data, block, channels, decompressor)
+	if err != nil {
+		return err
 	}
+	return exr.ReadBlock(buffer, block, channels, dataChannels)
+}
 
-	for i := 0; i < chunkCount; i++ {
-		if err := exr.ReadScanLineBlock(in, dataWindow, compression, decompressor, dataChannels); err != nil {
-			return nil, fmt.Errorf("error reading scan line block: %w", err)
-		}
-	}
+func boxToRect(box exr.Box2i) image.Rectangle {
+	return image.Rect(
+		int(box.XMin), int(box.YMin),
+		int(box.XMax)+1, int(box.YMax)+1,
+	)
+}
 
-	return &RGBAImage{
-		rect: image.Rect(
-			int(displayWindow.XMin), int(displayWindow.YMin),
-			int(displayWindow.XMax+1), int(displayWindow.YMax+1),
-		),
-		channelR: dataChannelR,
-		channelG: dataChannelG,
-		channelB: dataChannelB,
-		channelA: dataChannelA,
-	}, nil
+func validateSampling(channel exr.Channel, dataWindow exr.Box2i) error {
+	if channel.XSampling < 1 || channel.YSampling < 1 {
+		return fmt.Errorf("invalid sampling (%d x %d)", channel.XSampling, channel.YSampling)
+	}
+	if dataWindow.XMin%channel.XSampling != 0 || dataWindow.Width()%channel.XSampling != 0 {
+		return fmt.Errorf("data window not aligned to x sampling %d", channel.XSampling)
+	}
+	if dataWindow.YMin%channel.YSampling != 0 || dataWindow.Height()%channel.YSampling != 0 {
+		return fmt.Errorf("data window not aligned to y sampling %d", channel.YSampling)
+	}
+	return nil
 }
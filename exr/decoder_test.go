@@ -0,0 +1,507 @@
+package exr_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestDecodeWindows(t *testing.T) {
+	value := func(channel int, x, y int32) float32 {
+		return float32(x) + float32(y)*0.5
+	}
+	testCases := []struct {
+		name          string
+		dataWindow    internal.Box2i
+		displayWindow internal.Box2i
+		bounds        image.Rectangle
+	}{
+		{
+			name:          "data window contains display window",
+			dataWindow:    internal.Box2i{XMin: 0, YMin: 0, XMax: 5, YMax: 5},
+			displayWindow: internal.Box2i{XMin: 1, YMin: 1, XMax: 3, YMax: 3},
+			bounds:        image.Rect(1, 1, 4, 4),
+		},
+		{
+			name:          "data window smaller than display window",
+			dataWindow:    internal.Box2i{XMin: 2, YMin: 3, XMax: 5, YMax: 6},
+			displayWindow: internal.Box2i{XMin: 0, YMin: 0, XMax: 9, YMax: 9},
+			bounds:        image.Rect(2, 3, 6, 7),
+		},
+		{
+			name:          "data window offset from display window",
+			dataWindow:    internal.Box2i{XMin: -2, YMin: -1, XMax: 3, YMax: 4},
+			displayWindow: internal.Box2i{XMin: 0, YMin: 0, XMax: 5, YMax: 5},
+			bounds:        image.Rect(0, 0, 4, 5),
+		},
+		{
+			name:          "data window outside of display window",
+			dataWindow:    internal.Box2i{XMin: 10, YMin: 10, XMax: 12, YMax: 12},
+			displayWindow: internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 3},
+			bounds:        image.Rectangle{},
+		},
+	}
+	for _, tc := range testCases {
+		for _, tiled := range []bool{false, true} {
+			header := newTestHeader(tc.dataWindow, tc.displayWindow, newTestChannel("R", internal.PixelTypeFloat))
+			img := &testImage{header: header}
+			if tiled {
+				img.header.Type = internal.PartTypeTiled
+				img.header.Tiles = internal.TileDescription{XSize: 2, YSize: 3}
+				img.addTiles(t, func(level internal.Level, channel int, x, y int32) float32 {
+					return value(channel, x, y)
+				})
+			} else {
+				for y := tc.dataWindow.YMin; y <= tc.dataWindow.YMax; y++ {
+					block := internal.Box2i{XMin: tc.dataWindow.XMin, YMin: y, XMax: tc.dataWindow.XMax, YMax: y}
+					img.chunks = append(img.chunks, testChunk{
+						index: len(img.chunks),
+						data:  scanLineChunk(t, y, blockData(header.Channels, block, value)),
+					})
+				}
+			}
+
+			decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+			if err != nil {
+				t.Fatalf("%s (tiled: %t): error decoding image: %v", tc.name, tiled, err)
+			}
+			if decoded.Bounds() != tc.bounds {
+				t.Fatalf("%s (tiled: %t): got bounds %v, want %v", tc.name, tiled, decoded.Bounds(), tc.bounds)
+			}
+			for y := tc.bounds.Min.Y; y < tc.bounds.Max.Y; y++ {
+				for x := tc.bounds.Min.X; x < tc.bounds.Max.X; x++ {
+					if got, want := decoded.At(x, y).(exr.RGBAColor).R, value(0, int32(x), int32(y)); got != want {
+						t.Fatalf("%s (tiled: %t): pixel (%d, %d): got %v, want %v", tc.name, tiled, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeZIPS(t *testing.T) {
+	const width, height = 64, 5
+	value := func(channel int, x, y int32) float32 {
+		return float32(channel) + float32(x)*0.5 + float32(y)*0.25
+	}
+
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: width - 1, YMax: height - 1}
+	img := &testImage{
+		header: newTestHeader(dataWindow, dataWindow,
+			newTestChannel("B", internal.PixelTypeFloat),
+			newTestChannel("G", internal.PixelTypeFloat),
+			newTestChannel("R", internal.PixelTypeFloat),
+		),
+	}
+	img.header.Compression = internal.CompressionZIPS
+
+	// Each chunk of a ZIPS image holds a single line.
+	for y := int32(0); y < height; y++ {
+		block := internal.Box2i{XMin: 0, YMin: y, XMax: width - 1, YMax: y}
+		raw := blockData(img.header.Channels, block, value)
+		data := zipCompress(t, raw)
+		if len(data) >= len(raw) {
+			t.Fatalf("line %d is not smaller when compressed", y)
+		}
+		img.chunks = append(img.chunks, testChunk{index: int(y), data: scanLineChunk(t, y, data)})
+	}
+
+	decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	for y := int32(0); y < height; y++ {
+		for x := int32(0); x < width; x++ {
+			got := decoded.At(int(x), int(y)).(exr.RGBAColor)
+			want := exr.RGBAColor{R: value(2, x, y), G: value(1, x, y), B: value(0, x, y), A: 1}
+			if got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// zipCompress compresses data the way the ZIPS and ZIP compressions do, by
+// splitting it into its even and odd bytes, applying the delta predictor
+// and deflating the result.
+func zipCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	separated := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i += 2 {
+		separated = append(separated, data[i])
+	}
+	for i := 1; i < len(data); i += 2 {
+		separated = append(separated, data[i])
+	}
+	for i := len(separated) - 1; i > 0; i-- {
+		separated[i] = separated[i] - separated[i-1] + 128
+	}
+
+	out := &bytes.Buffer{}
+	zlibOut := zlib.NewWriter(out)
+	if _, err := zlibOut.Write(separated); err != nil {
+		t.Fatal(err)
+	}
+	if err := zlibOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestDecodePXR24Blocks(t *testing.T) {
+	const width, height = 3, 20
+	value := func(channel int, x, y int32) float32 {
+		return float32(x) + float32(y)*4
+	}
+
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: width - 1, YMax: height - 1}
+	img := &testImage{
+		header: newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat)),
+	}
+	img.header.Compression = internal.CompressionPXR24
+
+	// Each chunk of a PXR24 image holds 16 lines. The blocks are stored as
+	// is, which is only recognized as such if the block height is right.
+	for y := int32(0); y < height; y += 16 {
+		block := internal.Box2i{XMin: 0, YMin: y, XMax: width - 1, YMax: y + 15}
+		if block.YMax >= height {
+			block.YMax = height - 1
+		}
+		img.chunks = append(img.chunks, testChunk{
+			index: len(img.chunks),
+			data:  scanLineChunk(t, y, blockData(img.header.Channels, block, value)),
+		})
+	}
+
+	decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	for y := int32(0); y < height; y++ {
+		for x := int32(0); x < width; x++ {
+			if got, want := decoded.At(int(x), int(y)).(exr.RGBAColor).R, value(0, x, y); got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeDWABlocks(t *testing.T) {
+	const width, height = 5, 300
+	value := func(channel int, x, y int32) float32 {
+		return float32(x) + float32(y)*4
+	}
+
+	for _, tc := range []struct {
+		compression internal.Compression
+		lineCount   int32
+	}{
+		{compression: internal.CompressionDWAA, lineCount: 32},
+		{compression: internal.CompressionDWAB, lineCount: 256},
+	} {
+		dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: width - 1, YMax: height - 1}
+		img := &testImage{
+			header: newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat)),
+		}
+		img.header.Compression = tc.compression
+
+		for y := int32(0); y < height; y += tc.lineCount {
+			block := internal.Box2i{XMin: 0, YMin: y, XMax: width - 1, YMax: y + tc.lineCount - 1}
+			if block.YMax >= height {
+				block.YMax = height - 1
+			}
+			raw := blockData(img.header.Channels, block, value)
+			data := dwaUnknownBlock(t, raw)
+			if len(data) >= len(raw) {
+				t.Fatalf("%v: block at line %d is not smaller when compressed", tc.compression, y)
+			}
+			img.chunks = append(img.chunks, testChunk{index: len(img.chunks), data: scanLineChunk(t, y, data)})
+		}
+
+		decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+		if err != nil {
+			t.Fatalf("%v: error decoding image: %v", tc.compression, err)
+		}
+		for y := int32(0); y < height; y++ {
+			for x := int32(0); x < width; x++ {
+				if got, want := decoded.At(int(x), int(y)).(exr.RGBAColor).R, value(0, x, y); got != want {
+					t.Fatalf("%v: pixel (%d, %d): got %v, want %v", tc.compression, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// dwaUnknownBlock returns a version 2 DWA block without rules, so that all
+// channels are stored as is, compressed with zlib.
+func dwaUnknownBlock(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	compressed := &bytes.Buffer{}
+	zlibOut := zlib.NewWriter(compressed)
+	if _, err := zlibOut.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zlibOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	var sizes [11]uint64
+	sizes[0] = 2                        // version
+	sizes[1] = uint64(len(raw))         // unknown uncompressed size
+	sizes[2] = uint64(compressed.Len()) // unknown compressed size
+	internal.Write(out, sizes)
+	internal.Write(out, uint16(2)) // size of the rules, including itself
+	out.Write(compressed.Bytes())
+	return out.Bytes()
+}
+
+func TestDecodeTiled(t *testing.T) {
+	value := func(level internal.Level, channel int, x, y int32) float32 {
+		return float32(channel) + float32(x)*0.5 + float32(y)*8
+	}
+
+	// The 7x5 data window is split into 3x2 tiles, so the tiles in the last
+	// column and row are only partly covered.
+	dataWindow := internal.Box2i{XMin: -1, YMin: 2, XMax: 5, YMax: 6}
+	img := &testImage{
+		header: newTestHeader(dataWindow, dataWindow,
+			newTestChannel("G", internal.PixelTypeFloat),
+			newTestChannel("R", internal.PixelTypeHalf),
+		),
+	}
+	img.header.Type = internal.PartTypeTiled
+	img.header.Tiles = internal.TileDescription{XSize: 3, YSize: 2}
+	img.addTiles(t, value)
+	if len(img.chunks) != 9 {
+		t.Fatalf("got %d tiles, want 9", len(img.chunks))
+	}
+
+	// The tiles are stored in the reverse order of the offset table, with
+	// the first tile last.
+	for i, j := 0, len(img.chunks)-1; i < j; i, j = i+1, j-1 {
+		img.chunks[i], img.chunks[j] = img.chunks[j], img.chunks[i]
+	}
+
+	for _, lineOrder := range []internal.LineOrder{internal.LineOrderIncreasingY, internal.LineOrderDecreasingY, internal.LineOrderRandomY} {
+		img.header.LineOrder = lineOrder
+		decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+		if err != nil {
+			t.Fatalf("%v: error decoding image: %v", lineOrder, err)
+		}
+		if want := image.Rect(-1, 2, 6, 7); decoded.Bounds() != want {
+			t.Fatalf("%v: got bounds %v, want %v", lineOrder, decoded.Bounds(), want)
+		}
+		for y := int32(2); y <= 6; y++ {
+			for x := int32(-1); x <= 5; x++ {
+				got := decoded.At(int(x), int(y)).(exr.RGBAColor)
+				want := exr.RGBAColor{R: value(internal.Level{}, 1, x, y), G: value(internal.Level{}, 0, x, y), A: 1}
+				if got != want {
+					t.Fatalf("%v: pixel (%d, %d): got %v, want %v", lineOrder, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeLineOrder(t *testing.T) {
+	value := func(channel int, x, y int32) float32 {
+		return float32(x) + float32(y)*0.25
+	}
+
+	dataWindow := internal.Box2i{XMin: 0, YMin: 1, XMax: 3, YMax: 5}
+	header := newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat))
+	chunk := func(y int32) testChunk {
+		block := internal.Box2i{XMin: 0, YMin: y, XMax: 3, YMax: y}
+		return testChunk{index: int(y - 1), data: scanLineChunk(t, y, blockData(header.Channels, block, value))}
+	}
+
+	// The offsets of the offset table are not monotonic, since the chunks
+	// are not stored in the order of their lines.
+	testCases := []struct {
+		lineOrder internal.LineOrder
+		lines     []int32
+	}{
+		{lineOrder: internal.LineOrderIncreasingY, lines: []int32{1, 2, 3, 4, 5}},
+		{lineOrder: internal.LineOrderDecreasingY, lines: []int32{5, 4, 3, 2, 1}},
+		{lineOrder: internal.LineOrderRandomY, lines: []int32{3, 5, 1, 4, 2}},
+	}
+	for _, tc := range testCases {
+		img := &testImage{header: header}
+		img.header.LineOrder = tc.lineOrder
+		for _, y := range tc.lines {
+			img.chunks = append(img.chunks, chunk(y))
+		}
+
+		decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+		if err != nil {
+			t.Fatalf("%v: error decoding image: %v", tc.lineOrder, err)
+		}
+		for y := int32(1); y <= 5; y++ {
+			for x := int32(0); x <= 3; x++ {
+				if got, want := decoded.At(int(x), int(y)).(exr.RGBAColor).R, value(0, x, y); got != want {
+					t.Fatalf("%v: pixel (%d, %d): got %v, want %v", tc.lineOrder, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	scanLine := &testImage{header: header}
+	scanLine.header.LineOrder = 3
+	for y := int32(1); y <= 5; y++ {
+		scanLine.chunks = append(scanLine.chunks, chunk(y))
+	}
+	tiled := &testImage{header: header}
+	tiled.header.LineOrder = 3
+	tiled.header.Type = internal.PartTypeTiled
+	tiled.header.Tiles = internal.TileDescription{XSize: 4, YSize: 5}
+	tiled.addTiles(t, func(level internal.Level, channel int, x, y int32) float32 {
+		return value(channel, x, y)
+	})
+	for name, img := range map[string]*testImage{"scan line": scanLine, "tiled": tiled} {
+		if _, err := exr.Decode(bytes.NewReader(img.bytes(t))); err == nil {
+			t.Fatalf("%s: expected an error for an unknown line order", name)
+		}
+	}
+}
+
+func TestDecodeWorkers(t *testing.T) {
+	value := func(channel int, x, y int32) float32 {
+		return float32(channel) + float32(x)*0.5 + float32(y)*0.25
+	}
+
+	dataWindow := internal.Box2i{XMin: -3, YMin: 0, XMax: 29, YMax: 99}
+	header := newTestHeader(dataWindow, dataWindow,
+		newTestChannel("B", internal.PixelTypeHalf),
+		newTestChannel("G", internal.PixelTypeFloat),
+		newTestChannel("R", internal.PixelTypeFloat),
+	)
+
+	scanLine := &testImage{header: header}
+	scanLine.header.Compression = internal.CompressionZIP
+	for y := dataWindow.YMin; y <= dataWindow.YMax; y += 16 {
+		block := internal.Box2i{XMin: dataWindow.XMin, YMin: y, XMax: dataWindow.XMax, YMax: y + 15}
+		if block.YMax > dataWindow.YMax {
+			block.YMax = dataWindow.YMax
+		}
+		scanLine.chunks = append(scanLine.chunks, testChunk{
+			index: len(scanLine.chunks),
+			data:  scanLineChunk(t, y, zipCompress(t, blockData(header.Channels, block, value))),
+		})
+	}
+
+	tiled := &testImage{header: header}
+	tiled.header.Type = internal.PartTypeTiled
+	tiled.header.Tiles = internal.TileDescription{XSize: 5, YSize: 4}
+	tiled.addTiles(t, func(level internal.Level, channel int, x, y int32) float32 {
+		return value(channel, x, y)
+	})
+
+	// Decoding with several workers has to produce the same image as
+	// decoding with a single one, which is best checked with -race.
+	for name, img := range map[string]*testImage{"scan line": scanLine, "tiled": tiled} {
+		data := img.bytes(t)
+		var images []image.Image
+		for _, workers := range []int{1, 8} {
+			decoded, err := exr.DecodeWithOptions(bytes.NewReader(data), &exr.DecodeOptions{Workers: workers})
+			if err != nil {
+				t.Fatalf("%s (workers: %d): error decoding image: %v", name, workers, err)
+			}
+			images = append(images, decoded)
+
+			decoder, err := exr.NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s (workers: %d): error creating decoder: %v", name, workers, err)
+			}
+			decoder.Workers = workers
+			region, err := decoder.DecodeRegion(image.Rect(0, 10, 20, 90))
+			if err != nil {
+				t.Fatalf("%s (workers: %d): error decoding region: %v", name, workers, err)
+			}
+			images = append(images, region)
+		}
+
+		for i, img := range images {
+			bounds := img.Bounds()
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					got := img.At(x, y).(exr.RGBAColor)
+					want := exr.RGBAColor{
+						R: value(2, int32(x), int32(y)),
+						G: value(1, int32(x), int32(y)),
+						B: value(0, int32(x), int32(y)),
+						A: 1,
+					}
+					if got != want {
+						t.Fatalf("%s (image %d): pixel (%d, %d): got %v, want %v", name, i, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeDuplicateChunks(t *testing.T) {
+	value := func(channel int, x, y int32) float32 {
+		return float32(x) + float32(y)*8
+	}
+
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 19}
+	header := newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat))
+	scanLineBlock := func(y int32, lineCount int32) []byte {
+		block := internal.Box2i{XMin: 0, YMin: y, XMax: 3, YMax: y + lineCount - 1}
+		if block.YMax > dataWindow.YMax {
+			block.YMax = dataWindow.YMax
+		}
+		return scanLineChunk(t, y, blockData(header.Channels, block, value))
+	}
+
+	// The second chunk holds the same line as the first one.
+	duplicateLine := &testImage{header: header}
+	for y := int32(0); y <= dataWindow.YMax; y++ {
+		duplicateLine.chunks = append(duplicateLine.chunks, testChunk{index: int(y), data: scanLineBlock(y, 1)})
+	}
+	duplicateLine.chunks[1].data = scanLineBlock(0, 1)
+
+	// The second chunk of 16 lines starts on the second line, so it
+	// overlaps with the first one.
+	misalignedLine := &testImage{header: header}
+	misalignedLine.header.Compression = internal.CompressionZIP
+	misalignedLine.chunks = []testChunk{
+		{index: 0, data: scanLineBlock(0, 16)},
+		{index: 1, data: scanLineBlock(1, 16)},
+	}
+
+	// The second tile has the same coordinates as the first one.
+	duplicateTile := &testImage{header: header}
+	duplicateTile.header.Type = internal.PartTypeTiled
+	duplicateTile.header.Tiles = internal.TileDescription{XSize: 4, YSize: 10}
+	duplicateTile.addTiles(t, func(level internal.Level, channel int, x, y int32) float32 {
+		return value(channel, x, y)
+	})
+	duplicateTile.chunks[1].data = duplicateTile.chunks[0].data
+
+	testCases := []struct {
+		name string
+		img  *testImage
+	}{
+		{name: "duplicate scan line chunk", img: duplicateLine},
+		{name: "misaligned scan line chunk", img: misalignedLine},
+		{name: "duplicate tile chunk", img: duplicateTile},
+	}
+	for _, tc := range testCases {
+		data := tc.img.bytes(t)
+		for _, workers := range []int{1, 8} {
+			if _, err := exr.DecodeWithOptions(bytes.NewReader(data), &exr.DecodeOptions{Workers: workers}); err == nil {
+				t.Fatalf("%s (workers: %d): expected an error", tc.name, workers)
+			}
+		}
+		if _, err := exr.DecodeRegion(bytes.NewReader(data), image.Rect(0, 0, 4, 20)); err == nil {
+			t.Fatalf("%s: expected an error from DecodeRegion", tc.name)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package exr
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// DeepSample represents a single sample of a pixel of a DeepImage.
+type DeepSample struct {
+
+	// Z holds the depth of the front of the sample.
+	Z float32
+
+	// ZBack holds the depth of the back of the sample. It is equal to Z
+	// for samples that are not volumetric.
+	ZBack float32
+
+	// R holds the red component of the sample.
+	R float32
+
+	// G holds the green component of the sample.
+	G float32
+
+	// B holds the blue component of the sample.
+	B float32
+
+	// A holds the alpha component of the sample.
+	A float32
+}
+
+// DeepImage represents an EXR image that holds deep data, where each pixel
+// can have any number of samples, including none.
+//
+// Even if the original image that is loaded does not contain all of the
+// Z, ZBack, R, G, B, and A components, default ones will be assigned.
+type DeepImage struct {
+	rect         image.Rectangle
+	data         *exr.DeepData
+	channelZ     int
+	channelZBack int
+	channelR     int
+	channelG     int
+	channelB     int
+	channelA     int
+
+	attributes Attributes
+}
+
+// Attributes returns the attributes of the image, including custom ones.
+func (i *DeepImage) Attributes() Attributes {
+	return i.attributes
+}
+
+// Bounds returns the domain for which SampleCount can return a non-zero
+// number of samples. The bounds do not necessarily contain the point (0, 0).
+func (i *DeepImage) Bounds() image.Rectangle {
+	return i.rect
+}
+
+// SampleCount returns the number of samples of the pixel at (x, y).
+func (i *DeepImage) SampleCount(x, y int) int {
+	if !(image.Point{x, y}.In(i.rect)) {
+		return 0
+	}
+	return i.data.SampleCount(x, y)
+}
+
+// Sample returns the sample with the specified index of the pixel at
+// (x, y). Samples are returned in the order in which they are stored in the
+// image, which need not be sorted by depth.
+func (i *DeepImage) Sample(x, y, index int) DeepSample {
+	if index < 0 || index >= i.SampleCount(x, y) {
+		return DeepSample{}
+	}
+	sample := DeepSample{
+		Z: i.float32(i.channelZ, x, y, index, 0.0),
+		R: i.float32(i.channelR, x, y, index, 0.0),
+		G: i.float32(i.channelG, x, y, index, 0.0),
+		B: i.float32(i.channelB, x, y, index, 0.0),
+		A: i.float32(i.channelA, x, y, index, 1.0),
+	}
+	sample.ZBack = i.float32(i.channelZBack, x, y, index, sample.Z)
+	return sample
+}
+
+func (i *DeepImage) float32(channel, x, y, index int, fallback float32) float32 {
+	if channel < 0 {
+		return fallback
+	}
+	return i.data.Float32(channel, x, y, index)
+}
+
+// DecodeDeep reads a deep EXR image from in. For multipart images, the
+// first part is decoded. The bounds of the image are the part of the
+// display window that is covered by the data window.
+//
+// Only a limited set of deep EXR images are supported at the moment.
+// The main restrictions are as follows, though others apply as well:
+//
+//   - They have to be deep scan line or deep tiled images. For deep tiled
+//     images only the highest resolution level is decoded (see
+//     DecodeDeepLevel).
+//   - They have to use no compression, RLE or zip (ZIPS / ZIP) compression.
+func DecodeDeep(in io.Reader) (*DeepImage, error) {
+	version, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDeepPart(in, version, headers, 0, exr.Level{})
+}
+
+// DecodeDeepPart reads the deep part with the specified name from an EXR
+// image.
+//
+// The same restrictions that apply to DecodeDeep apply here as well.
+func DecodeDeepPart(in io.Reader, name string) (*DeepImage, error) {
+	version, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	for i, header := range headers {
+		if header.Name == name {
+			return decodeDeepPart(in, version, headers, i, exr.Level{})
+		}
+	}
+	return nil, fmt.Errorf("part %q not found", name)
+}
+
+// DecodeDeepLevel reads the (x, y) resolution level of a deep EXR image
+// from in.
+//
+// Level (0, 0) is decoded in the same way as with DecodeDeep. All other
+// levels have bounds that start at the origin of the data window of the
+// image and span the dimensions of the level (see DecodeLevels).
+//
+// For multipart images, the level is taken from the first part. The same
+// restrictions that apply to DecodeDeep apply here as well.
+func DecodeDeepLevel(in io.Reader, x, y int) (*DeepImage, error) {
+	version, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDeepPart(in, version, headers, 0, exr.Level{X: x, Y: y})
+}
+
+func decodeDeepPart(in io.Reader, version exr.Version, headers []exr.Header, part int, level exr.Level) (*DeepImage, error) {
+	header := headers[part]
+
+	var (
+		img         *DeepImage
+		decodeChunk chunkDecoder
+		err         error
+	)
+	switch header.Type {
+	case exr.PartTypeDeepScanLine:
+		if level != (exr.Level{}) {
+			return nil, fmt.Errorf("level (%d, %d) not found", level.X, level.Y)
+		}
+		img, decodeChunk, err = newDeepScanLineDecoder(header)
+	case exr.PartTypeDeepTiled:
+		img, decodeChunk, err = newDeepTiledDecoder(header, level)
+	case exr.PartTypeScanLine, exr.PartTypeTiled:
+		return nil, fmt.Errorf("part %q does not hold deep data", header.Name)
+	default:
+		return nil, fmt.Errorf("unsupported part type %q", header.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img.attributes = newAttributes(header)
+
+	if err := readPartChunks(in, version, headers, part, decodeChunk, 0); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func newDeepScanLineDecoder(header exr.Header) (*DeepImage, chunkDecoder, error) {
+	dataWindow := header.DataWindow
+	if dataWindow.Width() <= 0 || dataWindow.Height() <= 0 {
+		return nil, nil, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+	}
+	if err := header.LineOrder.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid line order: %w", err)
+	}
+
+	displayWindow := header.DisplayWindow
+
+	decompressor, err := newDeepDecompressor(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rect := boxToRect(displayWindow).Intersect(boxToRect(dataWindow))
+	img, err := newDeepImage(header.Channels, dataWindow, rect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[int32]bool)
+	decodeChunk := func(in io.Reader) (chunkTask, error) {
+		var chunk exr.DeepScanLineChunk
+		if err := exr.ReadDeepScanLineChunk(in, &chunk); err != nil {
+			return nil, fmt.Errorf("error reading deep scan line chunk: %w", err)
+		}
+		block, err := exr.ScanLineBlock(dataWindow, header.Compression, chunk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deep scan line chunk: %w", err)
+		}
+		if seen[chunk.Y] {
+			return nil, fmt.Errorf("duplicate deep scan line chunk at line %d", chunk.Y)
+		}
+		seen[chunk.Y] = true
+		return func() error {
+			if err := readDeepBlock(chunk.DeepChunkData, block, decompressor, img.data); err != nil {
+				return fmt.Errorf("error reading deep scan line block: %w", err)
+			}
+			return nil
+		}, nil
+	}
+	return img, decodeChunk, nil
+}
+
+func newDeepTiledDecoder(header exr.Header, level exr.Level) (*DeepImage, chunkDecoder, error) {
+	dataWindow := header.DataWindow
+	if dataWindow.Width() <= 0 || dataWindow.Height() <= 0 {
+		return nil, nil, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+	}
+	if err := header.LineOrder.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid line order: %w", err)
+	}
+
+	displayWindow := header.DisplayWindow
+
+	tiles := header.Tiles
+	if err := tiles.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid tiles: %w", err)
+	}
+	if !tiles.HasLevel(dataWindow, level) {
+		return nil, nil, fmt.Errorf("level (%d, %d) not found", level.X, level.Y)
+	}
+
+	decompressor, err := newDeepDecompressor(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	levelWindow := tiles.LevelWindow(dataWindow, level)
+	rect := boxToRect(levelWindow)
+	if level == (exr.Level{}) {
+		rect = rect.Intersect(boxToRect(displayWindow))
+	}
+	img, err := newDeepImage(header.Channels, levelWindow, rect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[exr.TileCoordinates]bool)
+	decodeChunk := func(in io.Reader) (chunkTask, error) {
+		var chunk exr.DeepTileChunk
+		if err := exr.ReadDeepTileChunk(in, &chunk); err != nil {
+			return nil, fmt.Errorf("error reading deep tile chunk: %w", err)
+		}
+		if chunk.Level() != level {
+			return nil, nil
+		}
+		block, err := tileBlock(tiles, levelWindow, chunk.TileCoordinates)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deep tile chunk: %w", err)
+		}
+		if seen[chunk.TileCoordinates] {
+			return nil, fmt.Errorf("duplicate deep tile chunk (%d, %d)", chunk.X, chunk.Y)
+		}
+		seen[chunk.TileCoordinates] = true
+		return func() error {
+			if err := readDeepBlock(chunk.DeepChunkData, block, decompressor, img.data); err != nil {
+				return fmt.Errorf("error reading deep tile block: %w", err)
+			}
+			return nil
+		}, nil
+	}
+	return img, decodeChunk, nil
+}
+
+func newDeepDecompressor(header exr.Header) (exr.Decompressor, error) {
+	switch compression := header.Compression; compression {
+	case exr.CompressionNone:
+		return exr.NewNopDecompressor(), nil
+	case exr.CompressionRLE:
+		return exr.NewRLEDecompressor(), nil
+	case exr.CompressionZIPS, exr.CompressionZIP:
+		return exr.NewZipDecompressor(), nil
+	default:
+		return nil, fmt.Errorf("unsupported deep compression %q", compression)
+	}
+}
+
+// newDeepImage creates a DeepImage with the specified bounds, which can
+// hold the samples of the specified channels within the specified window.
+func newDeepImage(channels exr.ChannelList, window exr.Box2i, rect image.Rectangle) (*DeepImage, error) {
+	img := &DeepImage{
+		rect:         rect,
+		data:         exr.NewDeepData(window, channels),
+		channelZ:     -1,
+		channelZBack: -1,
+		channelR:     -1,
+		channelG:     -1,
+		channelB:     -1,
+		channelA:     -1,
+	}
+	for i, channel := range channels {
+		if channel.XSampling != 1 || channel.YSampling != 1 {
+			return nil, fmt.Errorf("invalid channel %q: deep images cannot be subsampled", channel.Name)
+		}
+		switch channel.Name {
+		case "Z":
+			img.channelZ = i
+		case "ZBack":
+			img.channelZBack = i
+		case "R":
+			img.channelR = i
+		case "G":
+			img.channelG = i
+		case "B":
+			img.channelB = i
+		case "A":
+			img.channelA = i
+		}
+	}
+	return img, nil
+}
+
+func readDeepBlock(data exr.DeepChunkData, block exr.Box2i, decompressor exr.Decompressor, deepData *exr.DeepData) error {
+	table, samples, err := exr.DecompressDeepBlock(data, block, decompressor)
+	if err != nil {
+		return err
+	}
+	return deepData.ReadBlock(table, samples, block)
+}
@@ -0,0 +1,270 @@
+package exr_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// deepTestCount returns the number of samples of the pixel at (x, y) in the
+// deep test images, which is zero for some of the pixels.
+func deepTestCount(x, y int32) int {
+	return int(x+2*y) % 4
+}
+
+// deepTestValue returns the value of the specified channel of a sample in
+// the deep test images, which have the channels A, R and Z.
+func deepTestValue(channel int, x, y int32, sample int) float32 {
+	switch channel {
+	case 0:
+		return float32(sample+1) * 0.25
+	case 1:
+		return float32(x*10+y) + float32(sample)*0.5
+	default:
+		return float32(sample) + float32(y)*0.125
+	}
+}
+
+// checkDeepImage checks that the samples of img within bounds match the
+// ones returned by count and value.
+func checkDeepImage(t *testing.T, name string, img *exr.DeepImage, bounds image.Rectangle, count func(x, y int32) int, value func(channel int, x, y int32, sample int) float32) {
+	t.Helper()
+	if img.Bounds() != bounds {
+		t.Fatalf("%s: got bounds %v, want %v", name, img.Bounds(), bounds)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			n := count(int32(x), int32(y))
+			if got := img.SampleCount(x, y); got != n {
+				t.Fatalf("%s: pixel (%d, %d): got %d samples, want %d", name, x, y, got, n)
+			}
+			for s := 0; s < n; s++ {
+				z := value(2, int32(x), int32(y), s)
+				want := exr.DeepSample{
+					Z:     z,
+					ZBack: z,
+					R:     value(1, int32(x), int32(y), s),
+					A:     value(0, int32(x), int32(y), s),
+				}
+				if got := img.Sample(x, y, s); got != want {
+					t.Fatalf("%s: pixel (%d, %d), sample %d: got %+v, want %+v", name, x, y, s, got, want)
+				}
+			}
+		}
+	}
+}
+
+func newDeepTestHeader(dataWindow internal.Box2i) internal.Header {
+	header := newTestHeader(dataWindow, dataWindow,
+		newTestChannel("A", internal.PixelTypeHalf),
+		newTestChannel("R", internal.PixelTypeFloat),
+		newTestChannel("Z", internal.PixelTypeFloat),
+	)
+	header.Type = internal.PartTypeDeepScanLine
+	return header
+}
+
+func TestDecodeDeepScanLine(t *testing.T) {
+	dataWindow := internal.Box2i{XMin: 1, YMin: 2, XMax: 64, YMax: 4}
+	bounds := image.Rect(1, 2, 65, 5)
+
+	testCases := []struct {
+		compression internal.Compression
+		lineCount   int32
+		compress    bool
+	}{
+		{compression: internal.CompressionNone, lineCount: 1},
+		{compression: internal.CompressionZIPS, lineCount: 1, compress: true},
+		{compression: internal.CompressionZIP, lineCount: 16, compress: true},
+		{compression: internal.CompressionZIP, lineCount: 16},
+	}
+	for _, tc := range testCases {
+		img := &testImage{header: newDeepTestHeader(dataWindow)}
+		img.header.Compression = tc.compression
+		for y := dataWindow.YMin; y <= dataWindow.YMax; y += tc.lineCount {
+			block := internal.Box2i{XMin: dataWindow.XMin, YMin: y, XMax: dataWindow.XMax, YMax: y + tc.lineCount - 1}
+			if block.YMax > dataWindow.YMax {
+				block.YMax = dataWindow.YMax
+			}
+			table, samples := deepBlockData(img.header.Channels, block, deepTestCount, deepTestValue)
+			unpackedSize := len(samples)
+			if tc.compress {
+				// The table and the data are only stored compressed if
+				// that makes them smaller.
+				table = zipCompress(t, table)
+				samples = zipCompress(t, samples)
+				if len(table) >= int(block.Width())*int(block.Height())*4 || len(samples) >= unpackedSize {
+					t.Fatalf("%v: block at line %d is not smaller when compressed", tc.compression, y)
+				}
+			}
+			img.chunks = append(img.chunks, testChunk{
+				index: len(img.chunks),
+				data:  deepScanLineChunk(y, deepChunkData(table, samples, unpackedSize)),
+			})
+		}
+
+		decoded, err := exr.DecodeDeep(bytes.NewReader(img.bytes(t)))
+		if err != nil {
+			t.Fatalf("%v: error decoding image: %v", tc.compression, err)
+		}
+		checkDeepImage(t, tc.compression.String(), decoded, bounds, deepTestCount, deepTestValue)
+	}
+}
+
+func TestDecodeDeepScanLineInvalidTable(t *testing.T) {
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 2, YMax: 0}
+	_, samples := deepBlockData(newDeepTestHeader(dataWindow).Channels, dataWindow,
+		func(x, y int32) int { return 1 }, deepTestValue)
+
+	testCases := []struct {
+		name  string
+		table []int32
+	}{
+		{name: "decreasing count", table: []int32{2, 1, 3}},
+		{name: "count that does not match the data", table: []int32{1, 2, 4}},
+	}
+	for _, tc := range testCases {
+		table := &bytes.Buffer{}
+		internal.Write(table, tc.table)
+		img := &testImage{header: newDeepTestHeader(dataWindow)}
+		img.chunks = []testChunk{{data: deepScanLineChunk(0, deepChunkData(table.Bytes(), samples, len(samples)))}}
+		if _, err := exr.DecodeDeep(bytes.NewReader(img.bytes(t))); err == nil {
+			t.Fatalf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestDecodeDeepDuplicateChunks(t *testing.T) {
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 2, YMax: 1}
+	line := internal.Box2i{XMin: 0, YMin: 0, XMax: 2, YMax: 0}
+	table, samples := deepBlockData(newDeepTestHeader(dataWindow).Channels, line, deepTestCount, deepTestValue)
+	chunk := deepChunkData(table, samples, len(samples))
+
+	// Both chunks hold the first line, or the first tile.
+	scanLine := &testImage{header: newDeepTestHeader(dataWindow)}
+	scanLine.chunks = []testChunk{
+		{index: 0, data: deepScanLineChunk(0, chunk)},
+		{index: 1, data: deepScanLineChunk(0, chunk)},
+	}
+	tiled := &testImage{header: newDeepTestHeader(dataWindow)}
+	tiled.header.Type = internal.PartTypeDeepTiled
+	tiled.header.Tiles = internal.TileDescription{XSize: 3, YSize: 1}
+	tiled.chunks = []testChunk{
+		{index: 0, data: deepTileChunk(internal.TileCoordinates{}, chunk)},
+		{index: 1, data: deepTileChunk(internal.TileCoordinates{}, chunk)},
+	}
+	for name, img := range map[string]*testImage{"scan line": scanLine, "tiled": tiled} {
+		if _, err := exr.DecodeDeep(bytes.NewReader(img.bytes(t))); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDecodeDeepTiled(t *testing.T) {
+	// The value of each sample depends on the level, so that levels cannot
+	// be mistaken for one another.
+	levelValue := func(level internal.Level) func(channel int, x, y int32, sample int) float32 {
+		return func(channel int, x, y int32, sample int) float32 {
+			value := deepTestValue(channel, x, y, sample)
+			if channel == 1 {
+				value += float32(level.X * 1000)
+			}
+			return value
+		}
+	}
+
+	// The 8x5 data window is split into 3x2 tiles, so the tiles in the last
+	// column and row are only partly covered.
+	dataWindow := internal.Box2i{XMin: 1, YMin: 2, XMax: 8, YMax: 6}
+	img := &testImage{header: newDeepTestHeader(dataWindow)}
+	img.header.Type = internal.PartTypeDeepTiled
+	img.header.Tiles = internal.TileDescription{
+		XSize:        3,
+		YSize:        2,
+		LevelMode:    internal.LevelModeMipmap,
+		RoundingMode: internal.RoundingModeDown,
+	}
+	tiles := img.header.Tiles
+	for _, level := range tiles.Levels(dataWindow) {
+		levelWindow := tiles.LevelWindow(dataWindow, level)
+		for tileY := 0; tileY < tiles.TileCountY(levelWindow); tileY++ {
+			for tileX := 0; tileX < tiles.TileCountX(levelWindow); tileX++ {
+				coordinates := internal.TileCoordinates{
+					X:      int32(tileX),
+					Y:      int32(tileY),
+					LevelX: int32(level.X),
+					LevelY: int32(level.Y),
+				}
+				block := tiles.TileWindow(levelWindow, coordinates.X, coordinates.Y)
+				table, samples := deepBlockData(img.header.Channels, block, deepTestCount, levelValue(level))
+				img.chunks = append(img.chunks, testChunk{
+					index: len(img.chunks),
+					data:  deepTileChunk(coordinates, deepChunkData(table, samples, len(samples))),
+				})
+			}
+		}
+	}
+
+	// The tiles are stored in the reverse order of the offset table.
+	for i, j := 0, len(img.chunks)-1; i < j; i, j = i+1, j-1 {
+		img.chunks[i], img.chunks[j] = img.chunks[j], img.chunks[i]
+	}
+	data := img.bytes(t)
+
+	decoded, err := exr.DecodeDeep(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	checkDeepImage(t, "DecodeDeep", decoded, image.Rect(1, 2, 9, 7), deepTestCount, levelValue(internal.Level{}))
+
+	levels := []struct {
+		level  internal.Level
+		bounds image.Rectangle
+	}{
+		{level: internal.Level{X: 0, Y: 0}, bounds: image.Rect(1, 2, 9, 7)},
+		{level: internal.Level{X: 1, Y: 1}, bounds: image.Rect(1, 2, 5, 4)},
+		{level: internal.Level{X: 2, Y: 2}, bounds: image.Rect(1, 2, 3, 3)},
+		{level: internal.Level{X: 3, Y: 3}, bounds: image.Rect(1, 2, 2, 3)},
+	}
+	for _, l := range levels {
+		decoded, err := exr.DecodeDeepLevel(bytes.NewReader(data), l.level.X, l.level.Y)
+		if err != nil {
+			t.Fatalf("level %v: error decoding level: %v", l.level, err)
+		}
+		checkDeepImage(t, fmt.Sprintf("level %v", l.level), decoded, l.bounds, deepTestCount, levelValue(l.level))
+	}
+
+	for _, level := range []internal.Level{{X: 1, Y: 0}, {X: 4, Y: 4}} {
+		if _, err := exr.DecodeDeepLevel(bytes.NewReader(data), level.X, level.Y); err == nil {
+			t.Fatalf("level %v: expected an error", level)
+		}
+	}
+}
+
+func TestDecodeDeepLevelScanLine(t *testing.T) {
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 1}
+	img := &testImage{header: newDeepTestHeader(dataWindow)}
+	for y := dataWindow.YMin; y <= dataWindow.YMax; y++ {
+		block := internal.Box2i{XMin: dataWindow.XMin, YMin: y, XMax: dataWindow.XMax, YMax: y}
+		table, samples := deepBlockData(img.header.Channels, block, deepTestCount, deepTestValue)
+		img.chunks = append(img.chunks, testChunk{
+			index: len(img.chunks),
+			data:  deepScanLineChunk(y, deepChunkData(table, samples, len(samples))),
+		})
+	}
+	data := img.bytes(t)
+
+	decoded, err := exr.DecodeDeepLevel(bytes.NewReader(data), 0, 0)
+	if err != nil {
+		t.Fatalf("error decoding level: %v", err)
+	}
+	checkDeepImage(t, "level (0, 0)", decoded, image.Rect(0, 0, 4, 2), deepTestCount, deepTestValue)
+
+	if _, err := exr.DecodeDeepLevel(bytes.NewReader(data), 1, 1); err == nil {
+		t.Fatalf("level (1, 1): expected an error")
+	}
+}
@@ -1,2 +1,3 @@
-// Package exr contains an implementation of an OpenEXR image decoder.
+// Package exr contains an implementation of an OpenEXR image decoder and
+// encoder.
 package exr
@@ -0,0 +1,583 @@
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+	"github.com/x448/float16"
+)
+
+// Options holds settings that control how an image is encoded.
+type Options struct {
+
+	// Compression holds the compression of the pixel data. Only
+	// CompressionNone, CompressionZIPS, CompressionZIP and CompressionPIZ
+	// are supported at the moment.
+	Compression Compression
+
+	// ZIPLevel holds the zlib compression level that is used by the ZIPS
+	// and ZIP compressions, ranging from zlib.HuffmanOnly to
+	// zlib.BestCompression. The default level is used if it is zero.
+	ZIPLevel int
+
+	// Tiles holds the tile description of the image. The image is written
+	// as a tiled image if it is set and as a scan line image otherwise.
+	Tiles *TileDescription
+
+	// Filter holds the filter that is used to produce the lower resolution
+	// levels of tiled images that use the MIPMAP_LEVELS or RIPMAP_LEVELS
+	// level mode.
+	Filter Filter
+}
+
+// Encode writes the image img to out in EXR format. Default options, which
+// store the pixel data without compression, are used if opts is nil.
+//
+// The image is written as a single part scan line or tiled image, whose
+// data window and display window match the bounds of the image. The R, G,
+// B and A components are stored in FLOAT channels, so the values of an
+// RGBAImage are preserved exactly. Other images are converted through
+// RGBAModel.
+//
+// The lower resolution levels of tiled images are produced by repeatedly
+// halving the image with the filter that is specified by the options.
+func Encode(out io.Writer, img image.Image, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	rect := img.Bounds()
+	if rect.Empty() {
+		return fmt.Errorf("invalid image size (%d x %d)", rect.Dx(), rect.Dy())
+	}
+	pixels := newRGBAPlanarImage(img)
+
+	header, chunks, err := encodePart(pixels, pixels.window, opts)
+	if err != nil {
+		return err
+	}
+	version := exr.Version(exr.SupportedVersion)
+	if header.Type.IsTiled() {
+		version |= exr.Version(exr.FlagSingleTile)
+	}
+
+	headBuffer := &bytes.Buffer{}
+	if err := exr.WriteMagic(headBuffer, exr.MagicSequence); err != nil {
+		return fmt.Errorf("error writing magic: %w", err)
+	}
+	if err := exr.WriteVersion(headBuffer, version); err != nil {
+		return fmt.Errorf("error writing version: %w", err)
+	}
+	if err := exr.WriteHeader(headBuffer, header); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	return writeChunks(out, headBuffer.Bytes(), chunks)
+}
+
+// PartImage holds the contents of a single part of a multipart image that
+// is being encoded.
+type PartImage struct {
+
+	// Name holds the unique name of the part.
+	Name string
+
+	// DataWindow holds the bounds of the pixels of the part.
+	DataWindow image.Rectangle
+
+	// Channels holds the channels of the part, along with their values.
+	Channels []ChannelValues
+
+	// Options holds the settings that control how the part is encoded.
+	// Default options are used if it is nil.
+	Options *Options
+}
+
+// ChannelValues holds a channel of a part that is being encoded, along with
+// its values.
+type ChannelValues struct {
+	Channel
+
+	// Values holds the values of the channel in row-major order. Channels
+	// that are subsampled only have values for the pixels whose coordinates
+	// are divisible by their sampling.
+	//
+	// The values of UINT channels are truncated towards zero and clamped
+	// to the range of uint32, so whole numbers are preserved exactly up to
+	// 2^24. The values of HALF channels are rounded to the nearest half
+	// value.
+	Values []float32
+}
+
+// EncodeParts writes a multipart image that consists of the specified parts
+// to out in EXR format.
+//
+// Each part has its own channels, data window and options. The parts are
+// written in the specified order and share a display window, which is the
+// union of their data windows. Tiled parts cannot have subsampled channels.
+func EncodeParts(out io.Writer, parts []PartImage) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("no parts to encode")
+	}
+
+	names := make(map[string]struct{}, len(parts))
+	var displayRect image.Rectangle
+	for _, part := range parts {
+		if part.Name == "" {
+			return fmt.Errorf("missing part name")
+		}
+		if _, ok := names[part.Name]; ok {
+			return fmt.Errorf("duplicate part name %q", part.Name)
+		}
+		names[part.Name] = struct{}{}
+		displayRect = displayRect.Union(part.DataWindow)
+	}
+	displayWindow := rectToBox(displayRect)
+
+	version := exr.Version(exr.SupportedVersion) | exr.Version(exr.FlagMultipart)
+	headers := make([]exr.Header, len(parts))
+	var chunks [][]byte
+	for i, part := range parts {
+		opts := part.Options
+		if opts == nil {
+			opts = &Options{}
+		}
+		pixels, err := newPartPlanarImage(part)
+		if err != nil {
+			return fmt.Errorf("error encoding part %q: %w", part.Name, err)
+		}
+		header, partChunks, err := encodePart(pixels, displayWindow, opts)
+		if err != nil {
+			return fmt.Errorf("error encoding part %q: %w", part.Name, err)
+		}
+		header.Name = part.Name
+		headers[i] = header
+
+		for _, chunk := range partChunks {
+			chunkBuffer := &bytes.Buffer{}
+			if err := exr.WritePartNumber(chunkBuffer, int32(i)); err != nil {
+				return fmt.Errorf("error writing chunk: %w", err)
+			}
+			if _, err := chunkBuffer.Write(chunk); err != nil {
+				return fmt.Errorf("error writing chunk: %w", err)
+			}
+			chunks = append(chunks, chunkBuffer.Bytes())
+		}
+
+		for _, channel := range pixels.channels {
+			if len(channel.Name) > exr.MaxShortNameLength {
+				version |= exr.Version(exr.FlagLongName)
+			}
+		}
+	}
+
+	headBuffer := &bytes.Buffer{}
+	if err := exr.WriteMagic(headBuffer, exr.MagicSequence); err != nil {
+		return fmt.Errorf("error writing magic: %w", err)
+	}
+	if err := exr.WriteVersion(headBuffer, version); err != nil {
+		return fmt.Errorf("error writing version: %w", err)
+	}
+	if err := exr.WriteHeaders(headBuffer, headers); err != nil {
+		return fmt.Errorf("error writing headers: %w", err)
+	}
+	// The offset tables of the parts are stored one after another, so
+	// they form a single table of all chunks, in the order of the parts.
+	return writeChunks(out, headBuffer.Bytes(), chunks)
+}
+
+// encodePart returns the header and the chunks of a part that holds the
+// specified pixels.
+func encodePart(pixels *planarImage, displayWindow exr.Box2i, opts *Options) (exr.Header, [][]byte, error) {
+	compression := exr.Compression(opts.Compression)
+	compressor, err := newCompressor(compression, pixels.channels, opts)
+	if err != nil {
+		return exr.Header{}, nil, err
+	}
+
+	attributes, err := newDefaultAttributes()
+	if err != nil {
+		return exr.Header{}, nil, err
+	}
+	header := exr.Header{
+		Channels:      pixels.channels,
+		Compression:   compression,
+		DataWindow:    pixels.window,
+		DisplayWindow: displayWindow,
+		LineOrder:     exr.LineOrderIncreasingY,
+		Type:          exr.PartTypeScanLine,
+		Attributes:    attributes,
+	}
+	var chunks [][]byte
+	if opts.Tiles != nil {
+		if opts.Tiles.XSize < 1 || opts.Tiles.YSize < 1 || opts.Tiles.XSize > 1<<30 || opts.Tiles.YSize > 1<<30 {
+			return exr.Header{}, nil, fmt.Errorf("invalid tile size (%d x %d)", opts.Tiles.XSize, opts.Tiles.YSize)
+		}
+		header.Type = exr.PartTypeTiled
+		header.Tiles = exr.TileDescription{
+			XSize:        uint32(opts.Tiles.XSize),
+			YSize:        uint32(opts.Tiles.YSize),
+			LevelMode:    exr.LevelMode(opts.Tiles.LevelMode),
+			RoundingMode: exr.RoundingMode(opts.Tiles.RoundingMode),
+		}
+		if err := header.Tiles.Validate(); err != nil {
+			return exr.Header{}, nil, fmt.Errorf("invalid tiles: %w", err)
+		}
+		if !opts.Filter.isKnown() {
+			return exr.Header{}, nil, fmt.Errorf("unsupported filter %d", opts.Filter)
+		}
+		for _, channel := range pixels.channels {
+			if channel.XSampling != 1 || channel.YSampling != 1 {
+				return exr.Header{}, nil, fmt.Errorf("channel %q is subsampled, which is not supported by tiled images", channel.Name)
+			}
+		}
+		chunks, err = encodeTiles(pixels, header.Tiles, compressor, opts.Filter)
+	} else {
+		chunks, err = encodeScanLines(pixels, compression, compressor)
+	}
+	if err != nil {
+		return exr.Header{}, nil, err
+	}
+	header.ChunkCount = int32(len(chunks))
+	return header, chunks, nil
+}
+
+// encodeScanLines returns the chunks of a scan line image, in increasing y
+// order.
+func encodeScanLines(pixels *planarImage, compression exr.Compression, compressor exr.Compressor) ([][]byte, error) {
+	lineCount, err := compression.LineCount()
+	if err != nil {
+		return nil, err
+	}
+	var chunks [][]byte
+	window := pixels.window
+	for y := window.YMin; y <= window.YMax; y += int32(lineCount) {
+		block, err := exr.ScanLineBlock(window, compression, y)
+		if err != nil {
+			return nil, err
+		}
+		blockData, err := pixels.blockData(block)
+		if err != nil {
+			return nil, err
+		}
+		data, err := exr.CompressBlock(blockData, block, compressor)
+		if err != nil {
+			return nil, fmt.Errorf("error compressing block: %w", err)
+		}
+		chunkBuffer := &bytes.Buffer{}
+		if err := exr.WriteScanLineChunk(chunkBuffer, exr.ScanLineChunk{Y: y, Data: data}); err != nil {
+			return nil, fmt.Errorf("error writing chunk: %w", err)
+		}
+		chunks = append(chunks, chunkBuffer.Bytes())
+	}
+	return chunks, nil
+}
+
+// encodeTiles returns the chunks of a tiled image, in the order of the
+// levels and, within each level, in increasing y order.
+func encodeTiles(pixels *planarImage, tiles exr.TileDescription, compressor exr.Compressor, filter Filter) ([][]byte, error) {
+	dataWindow := pixels.window
+
+	// The levels are produced in the order in which they are stored, each
+	// one from the previous level, or in the case of the first level of a
+	// row of ripmap levels, from the first level of the previous row.
+	var (
+		chunks     [][]byte
+		levelImage *planarImage
+		rowImage   *planarImage
+	)
+	for _, level := range tiles.Levels(dataWindow) {
+		levelWindow := tiles.LevelWindow(dataWindow, level)
+		switch {
+		case level.X == 0 && level.Y == 0:
+			levelImage = pixels
+			rowImage = pixels
+		case tiles.LevelMode == exr.LevelModeRipmap && level.X == 0:
+			rowImage = rowImage.downsample(levelWindow, filter)
+			levelImage = rowImage
+		default:
+			levelImage = levelImage.downsample(levelWindow, filter)
+		}
+
+		for tileY := 0; tileY < tiles.TileCountY(levelWindow); tileY++ {
+			for tileX := 0; tileX < tiles.TileCountX(levelWindow); tileX++ {
+				block := tiles.TileWindow(levelWindow, int32(tileX), int32(tileY))
+				blockData, err := levelImage.blockData(block)
+				if err != nil {
+					return nil, err
+				}
+				data, err := exr.CompressBlock(blockData, block, compressor)
+				if err != nil {
+					return nil, fmt.Errorf("error compressing tile: %w", err)
+				}
+				chunkBuffer := &bytes.Buffer{}
+				if err := exr.WriteTileChunk(chunkBuffer, exr.TileChunk{
+					TileCoordinates: exr.TileCoordinates{
+						X:      int32(tileX),
+						Y:      int32(tileY),
+						LevelX: int32(level.X),
+						LevelY: int32(level.Y),
+					},
+					Data: data,
+				}); err != nil {
+					return nil, fmt.Errorf("error writing chunk: %w", err)
+				}
+				chunks = append(chunks, chunkBuffer.Bytes())
+			}
+		}
+	}
+	return chunks, nil
+}
+
+// rgbaChannels holds the channels that are written for the R, G, B and A
+// components of an image, sorted by name as required by the format.
+var rgbaChannels = exr.ChannelList{
+	{Name: "A", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+	{Name: "B", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+	{Name: "G", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+	{Name: "R", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+}
+
+// newDefaultAttributes returns the required attributes that are not held
+// by the fields of a header, set to their default values.
+func newDefaultAttributes() ([]exr.Attribute, error) {
+	defaults := []struct {
+		name          exr.AttributeName
+		attributeType exr.AttributeType
+		value         any
+	}{
+		{exr.AttributeNamePixelAspectRatio, exr.AttributeTypeFloat, float32(1.0)},
+		{exr.AttributeNameScreenWindowCenter, exr.AttributeTypeV2f, V2f{}},
+		{exr.AttributeNameScreenWindowWidth, exr.AttributeTypeFloat, float32(1.0)},
+	}
+	attributes := make([]exr.Attribute, len(defaults))
+	for i, attribute := range defaults {
+		var err error
+		if attributes[i], err = newAttribute(attribute.name, attribute.attributeType, attribute.value); err != nil {
+			return nil, fmt.Errorf("error writing attribute %q: %w", attribute.name, err)
+		}
+	}
+	return attributes, nil
+}
+
+// newAttribute creates an attribute that holds the specified fixed size
+// value.
+func newAttribute(name exr.AttributeName, attributeType exr.AttributeType, value any) (exr.Attribute, error) {
+	valueBuffer := &bytes.Buffer{}
+	if err := exr.Write(valueBuffer, value); err != nil {
+		return exr.Attribute{}, err
+	}
+	return exr.Attribute{
+		Name:  name,
+		Type:  attributeType,
+		Value: valueBuffer.Bytes(),
+	}, nil
+}
+
+func newCompressor(compression exr.Compression, channels exr.ChannelList, opts *Options) (exr.Compressor, error) {
+	switch compression {
+	case exr.CompressionNone:
+		return exr.NewNopCompressor(), nil
+	case exr.CompressionZIPS, exr.CompressionZIP:
+		level := opts.ZIPLevel
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		if level < zlib.HuffmanOnly || level > zlib.BestCompression {
+			return nil, fmt.Errorf("invalid zip compression level %d", level)
+		}
+		return exr.NewZipCompressor(level), nil
+	case exr.CompressionPIZ:
+		return exr.NewPizCompressor(channels), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+}
+
+// planarImage holds the values of the channels of an image that is being
+// encoded. The values of each channel are stored in a separate slice, in
+// row-major order.
+type planarImage struct {
+	window   exr.Box2i
+	channels exr.ChannelList
+	values   [][]float32
+}
+
+// newRGBAPlanarImage converts img into a planarImage with the channels
+// in rgbaChannels.
+func newRGBAPlanarImage(img image.Image) *planarImage {
+	rect := img.Bounds()
+	pixels := &planarImage{
+		window:   rectToBox(rect),
+		channels: rgbaChannels,
+		values:   make([][]float32, len(rgbaChannels)),
+	}
+	for i := range pixels.values {
+		pixels.values[i] = make([]float32, 0, rect.Dx()*rect.Dy())
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			color := RGBAModel.Convert(img.At(x, y)).(RGBAColor)
+			pixels.values[0] = append(pixels.values[0], color.A)
+			pixels.values[1] = append(pixels.values[1], color.B)
+			pixels.values[2] = append(pixels.values[2], color.G)
+			pixels.values[3] = append(pixels.values[3], color.R)
+		}
+	}
+	return pixels
+}
+
+// newPartPlanarImage returns a planarImage that holds the channels of a
+// part, sorted by name as required by the format.
+func newPartPlanarImage(part PartImage) (*planarImage, error) {
+	rect := part.DataWindow
+	if rect.Empty() {
+		return nil, fmt.Errorf("invalid data window size (%d x %d)", rect.Dx(), rect.Dy())
+	}
+	if len(part.Channels) == 0 {
+		return nil, fmt.Errorf("no channels to encode")
+	}
+
+	channels := make([]ChannelValues, len(part.Channels))
+	copy(channels, part.Channels)
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+
+	pixels := &planarImage{
+		window:   rectToBox(rect),
+		channels: make(exr.ChannelList, len(channels)),
+		values:   make([][]float32, len(channels)),
+	}
+	for i, channel := range channels {
+		if channel.Name == "" || len(channel.Name) > exr.MaxLongNameLength || strings.ContainsRune(channel.Name, 0) {
+			return nil, fmt.Errorf("invalid channel name %q", channel.Name)
+		}
+		if i > 0 && channel.Name == channels[i-1].Name {
+			return nil, fmt.Errorf("duplicate channel %q", channel.Name)
+		}
+		switch channel.PixelType {
+		case PixelTypeUint, PixelTypeHalf, PixelTypeFloat:
+		default:
+			return nil, fmt.Errorf("unsupported pixel type %q of channel %q", channel.PixelType, channel.Name)
+		}
+		exrChannel := exr.Channel{
+			Name:      channel.Name,
+			PixelType: exr.PixelType(channel.PixelType),
+			Linear:    channel.Linear,
+			XSampling: int32(channel.XSampling),
+			YSampling: int32(channel.YSampling),
+		}
+		if int(exrChannel.XSampling) != channel.XSampling || int(exrChannel.YSampling) != channel.YSampling {
+			return nil, fmt.Errorf("invalid sampling (%d x %d) of channel %q", channel.XSampling, channel.YSampling, channel.Name)
+		}
+		if err := validateSampling(exrChannel, pixels.window); err != nil {
+			return nil, fmt.Errorf("invalid channel %q: %w", channel.Name, err)
+		}
+		count := (rect.Dx() / channel.XSampling) * (rect.Dy() / channel.YSampling)
+		if len(channel.Values) != count {
+			return nil, fmt.Errorf("channel %q has %d values instead of %d", channel.Name, len(channel.Values), count)
+		}
+		pixels.channels[i] = exrChannel
+		pixels.values[i] = channel.Values
+	}
+	return pixels, nil
+}
+
+// blockData returns the uncompressed pixel data of the specified block,
+// which has to be contained by the window of the image.
+func (i *planarImage) blockData(block exr.Box2i) ([]byte, error) {
+	out := &bytes.Buffer{}
+	out.Grow(i.channels.BlockSize(block))
+	for y := block.YMin; y <= block.YMax; y++ {
+		for c, channel := range i.channels {
+			if exr.Mod(y, channel.YSampling) != 0 {
+				continue
+			}
+			// The samples that precede the block in its row and the rows
+			// that precede it are counted, to locate its first sample.
+			width := int(exr.NumSamples(channel.XSampling, i.window.XMin, i.window.XMax))
+			row := int(exr.NumSamples(channel.YSampling, i.window.YMin, y-1))
+			column := int(exr.NumSamples(channel.XSampling, i.window.XMin, block.XMin-1))
+			count := int(exr.NumSamples(channel.XSampling, block.XMin, block.XMax))
+			start := row*width + column
+			if err := writeValues(out, channel.PixelType, i.values[c][start:start+count]); err != nil {
+				return nil, fmt.Errorf("error writing channel %q: %w", channel.Name, err)
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// writeValues writes the values of a channel in the representation of the
+// specified pixel type.
+func writeValues(out io.Writer, pixelType exr.PixelType, values []float32) error {
+	switch pixelType {
+	case exr.PixelTypeUint:
+		data := make([]uint32, len(values))
+		for i, value := range values {
+			data[i] = uint32Value(value)
+		}
+		return exr.Write(out, data)
+	case exr.PixelTypeHalf:
+		data := make([]float16.Float16, len(values))
+		for i, value := range values {
+			data[i] = float16.Fromfloat32(value)
+		}
+		return exr.Write(out, data)
+	default:
+		return exr.Write(out, values)
+	}
+}
+
+// uint32Value converts value to an uint32, truncating it towards zero and
+// clamping it to the range of uint32. NaN values are converted to zero.
+func uint32Value(value float32) uint32 {
+	switch {
+	case !(value > 0):
+		return 0
+	case value >= math.MaxUint32:
+		return math.MaxUint32
+	default:
+		return uint32(value)
+	}
+}
+
+func rectToBox(rect image.Rectangle) exr.Box2i {
+	return exr.Box2i{
+		XMin: int32(rect.Min.X),
+		YMin: int32(rect.Min.Y),
+		XMax: int32(rect.Max.X - 1),
+		YMax: int32(rect.Max.Y - 1),
+	}
+}
+
+// writeChunks writes the head of an image, which consists of the magic,
+// version and header, followed by the offset table and the chunks.
+func writeChunks(out io.Writer, head []byte, chunks [][]byte) error {
+	offsets := make([]uint64, len(chunks))
+	offset := uint64(len(head) + 8*len(chunks))
+	for i, chunk := range chunks {
+		offsets[i] = offset
+		offset += uint64(len(chunk))
+	}
+
+	if _, err := out.Write(head); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	if err := exr.WriteOffsets(out, offsets); err != nil {
+		return fmt.Errorf("error writing offsets: %w", err)
+	}
+	for _, chunk := range chunks {
+		if _, err := out.Write(chunk); err != nil {
+			return fmt.Errorf("error writing chunk: %w", err)
+		}
+	}
+	return nil
+}
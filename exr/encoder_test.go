@@ -0,0 +1,595 @@
+package exr_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+	"github.com/x448/float16"
+)
+
+func TestEncode(t *testing.T) {
+	// The values are neither limited to [0, 1] nor representable as half
+	// values, so they are only preserved if they are stored as floats.
+	value := func(channel int, x, y int32) float32 {
+		return float32(channel)*0.3 + float32(x)*0.1 - float32(y)*1.7
+	}
+
+	// The 40x20 data window does not start at the origin and its height is
+	// not a multiple of 16, the number of lines in a ZIP block.
+	rect := image.Rect(-3, 2, 37, 22)
+	src := newTestRGBAImage(t, internal.Box2i{XMin: -3, YMin: 2, XMax: 36, YMax: 21}, value)
+
+	uncompressed := &bytes.Buffer{}
+	if err := exr.Encode(uncompressed, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, compression := range []exr.Compression{exr.CompressionNone, exr.CompressionZIPS, exr.CompressionZIP} {
+		out := &bytes.Buffer{}
+		if err := exr.Encode(out, src, &exr.Options{Compression: compression}); err != nil {
+			t.Fatalf("%v: error encoding image: %v", compression, err)
+		}
+		if compression != exr.CompressionNone && out.Len() >= uncompressed.Len() {
+			t.Fatalf("%v: image is not smaller than uncompressed one (%d >= %d)", compression, out.Len(), uncompressed.Len())
+		}
+
+		header, err := exr.DecodeHeader(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("%v: error decoding header: %v", compression, err)
+		}
+		if header.Compression != compression {
+			t.Fatalf("%v: got compression %v", compression, header.Compression)
+		}
+		if header.DataWindow != rect || header.DisplayWindow != rect {
+			t.Fatalf("%v: got windows %v and %v, want %v", compression, header.DataWindow, header.DisplayWindow, rect)
+		}
+		for i, name := range []string{"A", "B", "G", "R"} {
+			want := exr.Channel{Name: name, PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1}
+			if i >= len(header.Channels) || header.Channels[i] != want {
+				t.Fatalf("%v: got channels %v", compression, header.Channels)
+			}
+		}
+
+		img, err := exr.Decode(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("%v: error decoding image: %v", compression, err)
+		}
+		if img.Bounds() != rect {
+			t.Fatalf("%v: got bounds %v, want %v", compression, img.Bounds(), rect)
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if got, want := img.At(x, y), src.At(x, y); got != want {
+					t.Fatalf("%v: pixel (%d, %d): got %v, want %v", compression, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// newTestRGBAImage returns an RGBAImage that covers the specified window,
+// where value returns the value of the A, B, G or R component, in this
+// order, at the specified pixel.
+func newTestRGBAImage(t *testing.T, window internal.Box2i, value func(channel int, x, y int32) float32) *exr.RGBAImage {
+	t.Helper()
+	img := &testImage{
+		header: newTestHeader(window, window,
+			newTestChannel("A", internal.PixelTypeFloat),
+			newTestChannel("B", internal.PixelTypeFloat),
+			newTestChannel("G", internal.PixelTypeFloat),
+			newTestChannel("R", internal.PixelTypeFloat),
+		),
+	}
+	for y := window.YMin; y <= window.YMax; y++ {
+		block := internal.Box2i{XMin: window.XMin, YMin: y, XMax: window.XMax, YMax: y}
+		img.chunks = append(img.chunks, testChunk{
+			index: len(img.chunks),
+			data:  scanLineChunk(t, y, blockData(img.header.Channels, block, value)),
+		})
+	}
+	decoded, err := exr.Decode(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding test image: %v", err)
+	}
+	return decoded.(*exr.RGBAImage)
+}
+
+func TestEncodeConversion(t *testing.T) {
+	// Images of other types are converted through RGBAModel, which yields
+	// premultiplied components.
+	rect := image.Rect(1, 1, 4, 3)
+	nrgba := image.NewNRGBA(rect)
+	gray := image.NewGray16(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: 255, G: uint8(x * 50), B: 0, A: uint8(y * 100)})
+			gray.SetGray16(x, y, color.Gray16{Y: uint16(x * 0x4000)})
+		}
+	}
+
+	testCases := []struct {
+		name string
+		img  image.Image
+		want func(x, y int) exr.RGBAColor
+	}{
+		{
+			name: "NRGBA",
+			img:  nrgba,
+			want: func(x, y int) exr.RGBAColor {
+				a := float32(y*100) / 255
+				return exr.RGBAColor{R: a, G: float32(x*50) / 255 * a, B: 0, A: a}
+			},
+		},
+		{
+			name: "Gray16",
+			img:  gray,
+			want: func(x, y int) exr.RGBAColor {
+				v := float32(x*0x4000) / 0xFFFF
+				return exr.RGBAColor{R: v, G: v, B: v, A: 1}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+		if err := exr.Encode(out, tc.img, &exr.Options{Compression: exr.CompressionZIP}); err != nil {
+			t.Fatalf("%s: error encoding image: %v", tc.name, err)
+		}
+		img, err := exr.Decode(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: error decoding image: %v", tc.name, err)
+		}
+		if img.Bounds() != rect {
+			t.Fatalf("%s: got bounds %v, want %v", tc.name, img.Bounds(), rect)
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				got := img.At(x, y).(exr.RGBAColor)
+				want := tc.want(x, y)
+				for _, pair := range [][2]float32{{got.R, want.R}, {got.G, want.G}, {got.B, want.B}, {got.A, want.A}} {
+					if d := pair[0] - pair[1]; d > 1e-4 || d < -1e-4 {
+						t.Fatalf("%s: pixel (%d, %d): got %v, want %v", tc.name, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// The height of the test images is not a multiple of 32, the number of
+// lines in a PIZ block, so the last block is a partial one.
+var pizRect = image.Rect(-3, 2, 34, 47)
+
+func TestEncodePIZ(t *testing.T) {
+	src := image.NewNRGBA64(pizRect)
+	for y := pizRect.Min.Y; y < pizRect.Max.Y; y++ {
+		for x := pizRect.Min.X; x < pizRect.Max.X; x++ {
+			src.SetNRGBA64(x, y, color.NRGBA64{
+				R: uint16(x * 1000),
+				G: uint16(y * 1200),
+				B: uint16((x*x + y*7) * 31),
+				A: uint16(0xFFFF - x*y),
+			})
+		}
+	}
+
+	uncompressed := &bytes.Buffer{}
+	if err := exr.Encode(uncompressed, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	compressed := &bytes.Buffer{}
+	if err := exr.Encode(compressed, src, &exr.Options{Compression: exr.CompressionPIZ}); err != nil {
+		t.Fatal(err)
+	}
+	if compressed.Len() >= uncompressed.Len() {
+		t.Fatalf("PIZ image is not smaller than uncompressed one (%d >= %d)", compressed.Len(), uncompressed.Len())
+	}
+
+	img, err := exr.Decode(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	if img.Bounds() != pizRect {
+		t.Fatalf("got bounds %v, want %v", img.Bounds(), pizRect)
+	}
+	for y := pizRect.Min.Y; y < pizRect.Max.Y; y++ {
+		for x := pizRect.Min.X; x < pizRect.Max.X; x++ {
+			got := img.At(x, y)
+			want := exr.RGBAModel.Convert(src.At(x, y))
+			if got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodePartsPIZ(t *testing.T) {
+	value := func(channel, x, y int) float32 {
+		return float32(channel) + float32(x)*0.125 - float32(y)*0.375
+	}
+	channel := func(index int, name string, pixelType exr.PixelType) exr.ChannelValues {
+		result := exr.ChannelValues{
+			Channel: exr.Channel{Name: name, PixelType: pixelType, XSampling: 1, YSampling: 1},
+		}
+		for y := pizRect.Min.Y; y < pizRect.Max.Y; y++ {
+			for x := pizRect.Min.X; x < pizRect.Max.X; x++ {
+				result.Values = append(result.Values, value(index, x, y))
+			}
+		}
+		return result
+	}
+	part := exr.PartImage{
+		Name:       "beauty",
+		DataWindow: pizRect,
+		Channels: []exr.ChannelValues{
+			channel(0, "R", exr.PixelTypeHalf),
+			channel(1, "G", exr.PixelTypeFloat),
+			channel(2, "B", exr.PixelTypeHalf),
+			channel(3, "A", exr.PixelTypeFloat),
+			channel(4, "id", exr.PixelTypeUint),
+		},
+		Options: &exr.Options{Compression: exr.CompressionPIZ},
+	}
+
+	uncompressedPart := part
+	uncompressedPart.Options = nil
+	uncompressed := &bytes.Buffer{}
+	if err := exr.EncodeParts(uncompressed, []exr.PartImage{uncompressedPart}); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := exr.EncodeParts(out, []exr.PartImage{part}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() >= uncompressed.Len() {
+		t.Fatalf("PIZ image is not smaller than uncompressed one (%d >= %d)", out.Len(), uncompressed.Len())
+	}
+	img, err := exr.DecodePart(bytes.NewReader(out.Bytes()), "beauty")
+	if err != nil {
+		t.Fatalf("error decoding part: %v", err)
+	}
+	half := func(value float32) float32 {
+		return float16.Fromfloat32(value).Float32()
+	}
+	for y := pizRect.Min.Y; y < pizRect.Max.Y; y++ {
+		for x := pizRect.Min.X; x < pizRect.Max.X; x++ {
+			got := img.At(x, y).(exr.RGBAColor)
+			want := exr.RGBAColor{
+				R: half(value(0, x, y)),
+				G: value(1, x, y),
+				B: half(value(2, x, y)),
+				A: value(3, x, y),
+			}
+			if got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodePartsDataWindows(t *testing.T) {
+	value := func(x, y int) float32 {
+		return float32(x) + float32(y)*0.5
+	}
+	newPart := func(name string, rect image.Rectangle, opts *exr.Options) exr.PartImage {
+		channel := exr.ChannelValues{
+			Channel: exr.Channel{Name: "R", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				channel.Values = append(channel.Values, value(x, y))
+			}
+		}
+		return exr.PartImage{
+			Name:       name,
+			DataWindow: rect,
+			Channels:   []exr.ChannelValues{channel},
+			Options:    opts,
+		}
+	}
+	parts := []exr.PartImage{
+		newPart("full", image.Rect(0, 0, 4, 4), nil),
+		newPart("crop", image.Rect(1, 1, 3, 3), nil),
+		newPart("tiled", image.Rect(2, -1, 7, 3), &exr.Options{
+			Tiles: &exr.TileDescription{XSize: 2, YSize: 2},
+		}),
+	}
+	displayWindow := image.Rect(0, -1, 7, 4)
+
+	out := &bytes.Buffer{}
+	if err := exr.EncodeParts(out, parts); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+
+	headers, err := exr.DecodeHeaders(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding headers: %v", err)
+	}
+	for i, header := range headers {
+		if header.DataWindow != parts[i].DataWindow {
+			t.Fatalf("part %q: got data window %v, want %v", header.Name, header.DataWindow, parts[i].DataWindow)
+		}
+		if header.DisplayWindow != displayWindow {
+			t.Fatalf("part %q: got display window %v, want %v", header.Name, header.DisplayWindow, displayWindow)
+		}
+	}
+
+	for _, part := range parts {
+		img, err := exr.DecodePart(bytes.NewReader(data), part.Name)
+		if err != nil {
+			t.Fatalf("error decoding part %q: %v", part.Name, err)
+		}
+		decoder, err := exr.NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder.Part = part.Name
+		region, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("error decoding part %q with decoder: %v", part.Name, err)
+		}
+
+		for _, img := range []image.Image{img, region} {
+			if img.Bounds() != part.DataWindow {
+				t.Fatalf("part %q: got bounds %v, want %v", part.Name, img.Bounds(), part.DataWindow)
+			}
+			for y := part.DataWindow.Min.Y; y < part.DataWindow.Max.Y; y++ {
+				for x := part.DataWindow.Min.X; x < part.DataWindow.Max.X; x++ {
+					if got := img.At(x, y).(exr.RGBAColor).R; got != value(x, y) {
+						t.Fatalf("part %q, pixel (%d, %d): got %v, want %v", part.Name, x, y, got, value(x, y))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeZIPLevel(t *testing.T) {
+	rect := image.Rect(0, 0, 16, 16)
+	src := image.NewGray16(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			src.SetGray16(x, y, color.Gray16{Y: uint16(x * y * 200)})
+		}
+	}
+
+	// Zero selects the default level and the other valid levels range from
+	// zlib.HuffmanOnly (-2) to zlib.BestCompression (9).
+	for _, level := range []int{-2, -1, 0, 1, 9} {
+		for _, compression := range []exr.Compression{exr.CompressionZIPS, exr.CompressionZIP} {
+			out := &bytes.Buffer{}
+			if err := exr.Encode(out, src, &exr.Options{Compression: compression, ZIPLevel: level}); err != nil {
+				t.Fatalf("%v, level %d: error encoding image: %v", compression, level, err)
+			}
+			img, err := exr.Decode(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("%v, level %d: error decoding image: %v", compression, level, err)
+			}
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					if got, want := img.At(x, y), exr.RGBAModel.Convert(src.At(x, y)); got != want {
+						t.Fatalf("%v, level %d: pixel (%d, %d): got %v, want %v", compression, level, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+
+	for _, level := range []int{-3, 10, 100} {
+		if err := exr.Encode(&bytes.Buffer{}, src, &exr.Options{Compression: exr.CompressionZIP, ZIPLevel: level}); err == nil {
+			t.Fatalf("level %d: expected an error", level)
+		}
+		part := exr.PartImage{
+			Name:       "beauty",
+			DataWindow: rect,
+			Channels: []exr.ChannelValues{{
+				Channel: exr.Channel{Name: "Y", PixelType: exr.PixelTypeHalf, XSampling: 1, YSampling: 1},
+				Values:  make([]float32, rect.Dx()*rect.Dy()),
+			}},
+			Options: &exr.Options{Compression: exr.CompressionZIPS, ZIPLevel: level},
+		}
+		if err := exr.EncodeParts(&bytes.Buffer{}, []exr.PartImage{part}); err == nil {
+			t.Fatalf("level %d: expected an error from EncodeParts", level)
+		}
+	}
+}
+
+func TestEncodeZIPBlocks(t *testing.T) {
+	// The 40 lines are split into one chunk per line by ZIPS and into
+	// chunks of 16 lines by ZIP, the last of which is a partial one.
+	rect := image.Rect(0, 0, 8, 40)
+	channel := exr.ChannelValues{
+		Channel: exr.Channel{Name: "R", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			channel.Values = append(channel.Values, float32(x)+float32(y)*0.5)
+		}
+	}
+	parts := []exr.PartImage{
+		{
+			Name:       "zips",
+			DataWindow: rect,
+			Channels:   []exr.ChannelValues{channel},
+			Options:    &exr.Options{Compression: exr.CompressionZIPS},
+		},
+		{
+			Name:       "zip",
+			DataWindow: rect,
+			Channels:   []exr.ChannelValues{channel},
+			Options:    &exr.Options{Compression: exr.CompressionZIP},
+		},
+	}
+	out := &bytes.Buffer{}
+	if err := exr.EncodeParts(out, parts); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, err := exr.DecodeHeaders(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("error decoding headers: %v", err)
+	}
+	for i, want := range []int{40, 3} {
+		if headers[i].ChunkCount != want {
+			t.Fatalf("part %q: got %d chunks, want %d", headers[i].Name, headers[i].ChunkCount, want)
+		}
+	}
+	for _, part := range parts {
+		img, err := exr.DecodePart(bytes.NewReader(out.Bytes()), part.Name)
+		if err != nil {
+			t.Fatalf("error decoding part %q: %v", part.Name, err)
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if got, want := img.At(x, y).(exr.RGBAColor).R, float32(x)+float32(y)*0.5; got != want {
+					t.Fatalf("part %q: pixel (%d, %d): got %v, want %v", part.Name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeTiled(t *testing.T) {
+	// The values are the sums of a part that depends on x and one that
+	// depends on y, so the values of the lower resolution levels are the
+	// sums of the x and y parts filtered on their own, which are listed
+	// below relative to the 5x3 data window.
+	dataWindow := internal.Box2i{XMin: 2, YMin: 1, XMax: 6, YMax: 3}
+	value := func(channel int, x, y int32) float32 {
+		return float32(channel)*100 + float32(x-2) + float32(y-1)*8
+	}
+	src := newTestRGBAImage(t, dataWindow, value)
+
+	type levelValues struct {
+		x, y   int
+		xs, ys []float32
+	}
+	testCases := []struct {
+		name   string
+		tiles  exr.TileDescription
+		filter exr.Filter
+		levels []levelValues
+	}{
+		{
+			name:  "one level",
+			tiles: exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeOne},
+			levels: []levelValues{
+				{x: 0, y: 0, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 8, 16}},
+			},
+		},
+		{
+			// The box filter averages pairs of values, where the last value
+			// of an odd row or column is paired with itself.
+			name:   "mipmap, round down, box",
+			tiles:  exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeMipmap, RoundingMode: exr.RoundingModeDown},
+			filter: exr.FilterBox,
+			levels: []levelValues{
+				{x: 0, y: 0, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 8, 16}},
+				{x: 1, y: 1, xs: []float32{0.5, 2.5}, ys: []float32{4}},
+				{x: 2, y: 2, xs: []float32{1.5}, ys: []float32{4}},
+			},
+		},
+		{
+			name:   "mipmap, round up, box",
+			tiles:  exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeMipmap, RoundingMode: exr.RoundingModeUp},
+			filter: exr.FilterBox,
+			levels: []levelValues{
+				{x: 0, y: 0, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 8, 16}},
+				{x: 1, y: 1, xs: []float32{0.5, 2.5, 4}, ys: []float32{4, 16}},
+				{x: 2, y: 2, xs: []float32{1.5, 4}, ys: []float32{10}},
+				{x: 3, y: 3, xs: []float32{2.75}, ys: []float32{10}},
+			},
+		},
+		{
+			// The nearest filter keeps the first value of each pair.
+			name:   "mipmap, round up, nearest",
+			tiles:  exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeMipmap, RoundingMode: exr.RoundingModeUp},
+			filter: exr.FilterNearest,
+			levels: []levelValues{
+				{x: 0, y: 0, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 8, 16}},
+				{x: 1, y: 1, xs: []float32{0, 2, 4}, ys: []float32{0, 16}},
+				{x: 2, y: 2, xs: []float32{0, 4}, ys: []float32{0}},
+				{x: 3, y: 3, xs: []float32{0}, ys: []float32{0}},
+			},
+		},
+		{
+			name:   "ripmap, round down, box",
+			tiles:  exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeRipmap, RoundingMode: exr.RoundingModeDown},
+			filter: exr.FilterBox,
+			levels: []levelValues{
+				{x: 0, y: 0, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 8, 16}},
+				{x: 1, y: 0, xs: []float32{0.5, 2.5}, ys: []float32{0, 8, 16}},
+				{x: 2, y: 0, xs: []float32{1.5}, ys: []float32{0, 8, 16}},
+				{x: 0, y: 1, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{4}},
+				{x: 1, y: 1, xs: []float32{0.5, 2.5}, ys: []float32{4}},
+				{x: 2, y: 1, xs: []float32{1.5}, ys: []float32{4}},
+			},
+		},
+		{
+			name:   "ripmap, round up, nearest",
+			tiles:  exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeRipmap, RoundingMode: exr.RoundingModeUp},
+			filter: exr.FilterNearest,
+			levels: []levelValues{
+				{x: 0, y: 0, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 8, 16}},
+				{x: 1, y: 0, xs: []float32{0, 2, 4}, ys: []float32{0, 8, 16}},
+				{x: 2, y: 0, xs: []float32{0, 4}, ys: []float32{0, 8, 16}},
+				{x: 3, y: 0, xs: []float32{0}, ys: []float32{0, 8, 16}},
+				{x: 0, y: 1, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0, 16}},
+				{x: 1, y: 1, xs: []float32{0, 2, 4}, ys: []float32{0, 16}},
+				{x: 2, y: 1, xs: []float32{0, 4}, ys: []float32{0, 16}},
+				{x: 3, y: 1, xs: []float32{0}, ys: []float32{0, 16}},
+				{x: 0, y: 2, xs: []float32{0, 1, 2, 3, 4}, ys: []float32{0}},
+				{x: 1, y: 2, xs: []float32{0, 2, 4}, ys: []float32{0}},
+				{x: 2, y: 2, xs: []float32{0, 4}, ys: []float32{0}},
+				{x: 3, y: 2, xs: []float32{0}, ys: []float32{0}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tiles := tc.tiles
+		out := &bytes.Buffer{}
+		if err := exr.Encode(out, src, &exr.Options{Tiles: &tiles, Filter: tc.filter}); err != nil {
+			t.Fatalf("%s: error encoding image: %v", tc.name, err)
+		}
+		data := out.Bytes()
+
+		levels, err := exr.DecodeLevels(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: error decoding levels: %v", tc.name, err)
+		}
+		if len(levels) != len(tc.levels) {
+			t.Fatalf("%s: got %d levels, want %d", tc.name, len(levels), len(tc.levels))
+		}
+		for i, level := range tc.levels {
+			width, height := len(level.xs), len(level.ys)
+			if got := levels[i]; got.X != level.x || got.Y != level.y || got.Width != width || got.Height != height {
+				t.Fatalf("%s: level %d: got %+v, want (%d, %d) of %dx%d", tc.name, i, got, level.x, level.y, width, height)
+			}
+
+			img, err := exr.DecodeLevel(bytes.NewReader(data), level.x, level.y)
+			if err != nil {
+				t.Fatalf("%s: level (%d, %d): error decoding level: %v", tc.name, level.x, level.y, err)
+			}
+			if bounds := image.Rect(2, 1, 2+width, 1+height); img.Bounds() != bounds {
+				t.Fatalf("%s: level (%d, %d): got bounds %v, want %v", tc.name, level.x, level.y, img.Bounds(), bounds)
+			}
+			for row, ys := range level.ys {
+				for column, xs := range level.xs {
+					got := img.At(2+column, 1+row).(exr.RGBAColor)
+					want := exr.RGBAColor{R: 300 + xs + ys, G: 200 + xs + ys, B: 100 + xs + ys, A: xs + ys}
+					if got != want {
+						t.Fatalf("%s: level (%d, %d): pixel (%d, %d): got %v, want %v", tc.name, level.x, level.y, 2+column, 1+row, got, want)
+					}
+				}
+			}
+		}
+	}
+
+	tiles := exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeMipmap}
+	if err := exr.Encode(&bytes.Buffer{}, src, &exr.Options{Tiles: &tiles, Filter: 2}); err == nil {
+		t.Fatalf("expected an error for an unknown filter")
+	}
+}
@@ -0,0 +1,18 @@
+package exr
+
+import "fmt"
+
+// UnknownCompressionError is returned when an EXR image specifies a
+// compression that is not defined by the OpenEXR specification, which is
+// usually the case for corrupt images or images from a future version of
+// the format.
+type UnknownCompressionError struct {
+
+	// ID holds the raw compression identifier that is stored in the image.
+	ID uint8
+}
+
+// Error returns a description of the error.
+func (e *UnknownCompressionError) Error() string {
+	return fmt.Sprintf("unknown compression %d", e.ID)
+}
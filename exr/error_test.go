@@ -0,0 +1,81 @@
+package exr_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestUnknownCompressionError(t *testing.T) {
+	window := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 3}
+	img := &testImage{
+		header: newTestHeader(window, window, newTestChannel("R", internal.PixelTypeHalf)),
+	}
+	img.header.Compression = 42
+	data := img.bytes(t)
+
+	_, err := exr.Decode(bytes.NewReader(data))
+	var compressionErr *exr.UnknownCompressionError
+	if !errors.As(err, &compressionErr) {
+		t.Fatalf("Decode: got error %v, want an UnknownCompressionError", err)
+	}
+	if compressionErr.ID != 42 {
+		t.Fatalf("Decode: got compression %d, want 42", compressionErr.ID)
+	}
+
+	_, err = exr.DecodeConfig(bytes.NewReader(data))
+	compressionErr = nil
+	if !errors.As(err, &compressionErr) {
+		t.Fatalf("DecodeConfig: got error %v, want an UnknownCompressionError", err)
+	}
+	if compressionErr.ID != 42 {
+		t.Fatalf("DecodeConfig: got compression %d, want 42", compressionErr.ID)
+	}
+}
+
+func TestDecodeNegativeSizes(t *testing.T) {
+	window := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 0}
+	header := newTestHeader(window, window, newTestChannel("R", internal.PixelTypeHalf))
+
+	attribute := &bytes.Buffer{}
+	internal.WriteMagic(attribute, internal.MagicSequence)
+	internal.WriteVersion(attribute, internal.Version(internal.SupportedVersion))
+	internal.WriteNullTerminatedString(attribute, "channels")
+	internal.WriteNullTerminatedString(attribute, "chlist")
+	internal.Write(attribute, int32(-1))
+
+	scanLine := &testImage{header: header}
+	chunk := &bytes.Buffer{}
+	internal.Write(chunk, int32(0))  // y
+	internal.Write(chunk, int32(-8)) // data size
+	scanLine.chunks = []testChunk{{index: 0, data: chunk.Bytes()}}
+
+	tiled := &testImage{header: header}
+	tiled.header.Type = internal.PartTypeTiled
+	tiled.header.Tiles = internal.TileDescription{XSize: 4, YSize: 1}
+	chunk = &bytes.Buffer{}
+	internal.Write(chunk, [4]int32{0, 0, 0, 0}) // tile and level coordinates
+	internal.Write(chunk, int32(-8))            // data size
+	tiled.chunks = []testChunk{{index: 0, data: chunk.Bytes()}}
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "attribute size", data: attribute.Bytes()},
+		{name: "scan line block size", data: scanLine.bytes(t)},
+		{name: "tile block size", data: tiled.bytes(t)},
+	}
+	for _, tc := range testCases {
+		if _, err := exr.Decode(bytes.NewReader(tc.data)); err == nil {
+			t.Fatalf("%s: expected an error", tc.name)
+		}
+		if _, err := exr.DecodeRegion(bytes.NewReader(tc.data), image.Rect(0, 0, 4, 1)); err == nil {
+			t.Fatalf("%s: expected an error from DecodeRegion", tc.name)
+		}
+	}
+}
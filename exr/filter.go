@@ -0,0 +1,117 @@
+package exr
+
+import (
+	"fmt"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+const (
+	// FilterBox produces each pixel of a lower resolution level by
+	// averaging the pixels of the previous level that it covers.
+	FilterBox Filter = 0
+
+	// FilterNearest produces each pixel of a lower resolution level by
+	// taking the top-left pixel of the previous level that it covers.
+	FilterNearest Filter = 1
+)
+
+// Filter represents the way in which the lower resolution levels of a tiled
+// image are produced.
+type Filter uint8
+
+// String returns the name of the filter.
+func (f Filter) String() string {
+	switch f {
+	case FilterBox:
+		return "BOX"
+	case FilterNearest:
+		return "NEAREST"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", f)
+	}
+}
+
+func (f Filter) isKnown() bool {
+	return f == FilterBox || f == FilterNearest
+}
+
+// apply combines two neighbouring values of the previous level.
+func (f Filter) apply(a, b float32) float32 {
+	if f == FilterNearest {
+		return a
+	}
+	return (a + b) / 2
+}
+
+// downsample returns the image scaled down to the specified window, which
+// has to start at the same point as the window of the image and has to be
+// half its size in each direction, rounded either up or down.
+func (i *planarImage) downsample(window exr.Box2i, filter Filter) *planarImage {
+	result := i
+	if window.Width() != result.window.Width() {
+		result = result.downsampleX(window.Width(), filter)
+	}
+	if window.Height() != result.window.Height() {
+		result = result.downsampleY(window.Height(), filter)
+	}
+	return result
+}
+
+func (i *planarImage) downsampleX(width int32, filter Filter) *planarImage {
+	window := i.window
+	window.XMax = window.XMin + width - 1
+	result := &planarImage{
+		window:   window,
+		channels: i.channels,
+		values:   make([][]float32, len(i.values)),
+	}
+	srcWidth := int(i.window.Width())
+	dstWidth := int(width)
+	height := int(window.Height())
+	for c, src := range i.values {
+		dst := make([]float32, dstWidth*height)
+		for y := 0; y < height; y++ {
+			srcRow := src[y*srcWidth : (y+1)*srcWidth]
+			dstRow := dst[y*dstWidth : (y+1)*dstWidth]
+			for x := range dstRow {
+				dstRow[x] = filter.apply(srcRow[2*x], srcRow[minInt(2*x+1, srcWidth-1)])
+			}
+		}
+		result.values[c] = dst
+	}
+	return result
+}
+
+func (i *planarImage) downsampleY(height int32, filter Filter) *planarImage {
+	window := i.window
+	window.YMax = window.YMin + height - 1
+	result := &planarImage{
+		window:   window,
+		channels: i.channels,
+		values:   make([][]float32, len(i.values)),
+	}
+	width := int(window.Width())
+	srcHeight := int(i.window.Height())
+	dstHeight := int(height)
+	for c, src := range i.values {
+		dst := make([]float32, width*dstHeight)
+		for y := 0; y < dstHeight; y++ {
+			srcRowA := src[2*y*width : (2*y+1)*width]
+			srcRowB := src[minInt(2*y+1, srcHeight-1)*width:][:width]
+			dstRow := dst[y*width : (y+1)*width]
+			for x := range dstRow {
+				dstRow[x] = filter.apply(srcRowA[x], srcRowB[x])
+			}
+		}
+		result.values[c] = dst
+	}
+	return result
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
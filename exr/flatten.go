@@ -0,0 +1,218 @@
+package exr
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// Flatten composites the samples of each pixel of a deep image and returns
+// the result as an RGBAImage with the same bounds.
+//
+// The samples of each pixel are sorted by depth and volumetric samples are
+// split wherever they overlap other samples, so that overlapping parts can
+// be merged. The resulting samples are then composited front to back using
+// the over operation, as described in the "Interpreting OpenEXR Deep Pixels"
+// document of the OpenEXR specification.
+//
+// The result has the same attributes as the deep image.
+func Flatten(img *DeepImage) *RGBAImage {
+	rect := img.Bounds()
+	window := exr.Box2i{
+		XMin: int32(rect.Min.X),
+		YMin: int32(rect.Min.Y),
+		XMax: int32(rect.Max.X - 1),
+		YMax: int32(rect.Max.Y - 1),
+	}
+
+	pixelCount := rect.Dx() * rect.Dy()
+	pixelsR := make([]float32, pixelCount)
+	pixelsG := make([]float32, pixelCount)
+	pixelsB := make([]float32, pixelCount)
+	pixelsA := make([]float32, pixelCount)
+
+	var samples []DeepSample
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			samples = samples[:0]
+			for i := 0; i < img.SampleCount(x, y); i++ {
+				samples = append(samples, img.Sample(x, y, i))
+			}
+			color := flattenSamples(samples)
+
+			index := (y-rect.Min.Y)*rect.Dx() + (x - rect.Min.X)
+			pixelsR[index] = color.R
+			pixelsG[index] = color.G
+			pixelsB[index] = color.B
+			pixelsA[index] = color.A
+		}
+	}
+
+	return &RGBAImage{
+		rect:     rect,
+		channelR: exr.NewFloat32PixelDataFromPixels(window, pixelsR),
+		channelG: exr.NewFloat32PixelDataFromPixels(window, pixelsG),
+		channelB: exr.NewFloat32PixelDataFromPixels(window, pixelsB),
+		channelA: exr.NewFloat32PixelDataFromPixels(window, pixelsA),
+
+		attributes: img.attributes,
+	}
+}
+
+// flattenSamples composites the specified samples of a single pixel.
+func flattenSamples(samples []DeepSample) RGBAColor {
+	samples = tidySamples(samples)
+
+	var result RGBAColor
+	for _, sample := range samples {
+		if result.A >= 1.0 {
+			break
+		}
+		transparency := 1.0 - result.A
+		result.R += transparency * sample.R
+		result.G += transparency * sample.G
+		result.B += transparency * sample.B
+		result.A += transparency * sample.A
+	}
+	return result
+}
+
+// tidySamples returns samples that are sorted by depth and that do not
+// overlap each other. It does so by splitting volumetric samples at the
+// depths of all other samples and by merging samples that cover the same
+// depth range.
+func tidySamples(samples []DeepSample) []DeepSample {
+	depths := make([]float32, 0, 2*len(samples))
+	for _, sample := range samples {
+		depths = append(depths, sample.Z, sample.ZBack)
+	}
+	sort.Slice(depths, func(i, j int) bool {
+		return depths[i] < depths[j]
+	})
+
+	var split []DeepSample
+	for _, sample := range samples {
+		if !(sample.ZBack > sample.Z) {
+			sample.ZBack = sample.Z
+			split = append(split, sample)
+			continue
+		}
+		front := sample.Z
+		for _, depth := range depths {
+			if depth <= front {
+				continue
+			}
+			if depth >= sample.ZBack {
+				break
+			}
+			split = append(split, splitSample(sample, front, depth))
+			front = depth
+		}
+		split = append(split, splitSample(sample, front, sample.ZBack))
+	}
+	sort.SliceStable(split, func(i, j int) bool {
+		if split[i].Z != split[j].Z {
+			return split[i].Z < split[j].Z
+		}
+		return split[i].ZBack < split[j].ZBack
+	})
+
+	var result []DeepSample
+	for start := 0; start < len(split); {
+		end := start + 1
+		for end < len(split) && split[end].Z == split[start].Z && split[end].ZBack == split[start].ZBack {
+			end++
+		}
+		result = append(result, mergeSamples(split[start:end]))
+		start = end
+	}
+	return result
+}
+
+// splitSample returns the part of a volumetric sample that lies between
+// the front and back depths.
+func splitSample(sample DeepSample, front, back float32) DeepSample {
+	result := sample
+	result.Z = front
+	result.ZBack = back
+	if front == sample.Z && back == sample.ZBack {
+		return result
+	}
+
+	fraction := float64(back-front) / float64(sample.ZBack-sample.Z)
+	alpha := float64(sample.A)
+	switch {
+	case alpha >= 1.0:
+		// a fully opaque sample remains fully opaque
+	case alpha <= 0.0:
+		result.R = float32(float64(sample.R) * fraction)
+		result.G = float32(float64(sample.G) * fraction)
+		result.B = float32(float64(sample.B) * fraction)
+	default:
+		splitAlpha := -math.Expm1(fraction * math.Log1p(-alpha))
+		scale := splitAlpha / alpha
+		result.R = float32(float64(sample.R) * scale)
+		result.G = float32(float64(sample.G) * scale)
+		result.B = float32(float64(sample.B) * scale)
+		result.A = float32(splitAlpha)
+	}
+	return result
+}
+
+// mergeSamples combines samples that cover the same depth range into
+// a single sample.
+func mergeSamples(samples []DeepSample) DeepSample {
+	if len(samples) == 1 {
+		return samples[0]
+	}
+	result := DeepSample{
+		Z:     samples[0].Z,
+		ZBack: samples[0].ZBack,
+	}
+
+	// Fully opaque samples hide everything else, so the result is their
+	// average color.
+	opaqueCount := 0
+	for _, sample := range samples {
+		if sample.A >= 1.0 {
+			result.R += sample.R
+			result.G += sample.G
+			result.B += sample.B
+			opaqueCount++
+		}
+	}
+	if opaqueCount > 0 {
+		result.R /= float32(opaqueCount)
+		result.G /= float32(opaqueCount)
+		result.B /= float32(opaqueCount)
+		result.A = 1.0
+		return result
+	}
+
+	var u, vR, vG, vB float64
+	for _, sample := range samples {
+		alpha := float64(sample.A)
+		if alpha <= 0.0 {
+			vR += float64(sample.R)
+			vG += float64(sample.G)
+			vB += float64(sample.B)
+			continue
+		}
+		sampleU := -math.Log1p(-alpha)
+		u += sampleU
+		vR += float64(sample.R) * sampleU / alpha
+		vG += float64(sample.G) * sampleU / alpha
+		vB += float64(sample.B) * sampleU / alpha
+	}
+	alpha := -math.Expm1(-u)
+	scale := 1.0
+	if u > 0.0 {
+		scale = alpha / u
+	}
+	result.R = float32(vR * scale)
+	result.G = float32(vG * scale)
+	result.B = float32(vB * scale)
+	result.A = float32(alpha)
+	return result
+}
@@ -0,0 +1,102 @@
+package exr_test
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestFlatten(t *testing.T) {
+	// Each pixel of the 5x1 image covers a different case.
+	testCases := []struct {
+		name    string
+		samples []exr.DeepSample
+		want    exr.RGBAColor
+	}{
+		{
+			name: "no samples",
+			want: exr.RGBAColor{},
+		},
+		{
+			// The samples are stored back to front, so they need to be
+			// sorted before they are composited.
+			name: "unsorted samples",
+			samples: []exr.DeepSample{
+				{Z: 2, ZBack: 2, G: 1, A: 1},
+				{Z: 1, ZBack: 1, R: 0.5, A: 0.5},
+			},
+			want: exr.RGBAColor{R: 0.5, G: 0.5, A: 1},
+		},
+		{
+			// Both samples are split in half where they overlap, which
+			// halves the optical depth of each part, so each part has an
+			// alpha of 0.5. The two parts that overlap are merged into one
+			// with an alpha of 0.75 that is tinted equally by both.
+			name: "overlapping volumetric samples",
+			samples: []exr.DeepSample{
+				{Z: 0, ZBack: 2, R: 0.75, A: 0.75},
+				{Z: 1, ZBack: 3, G: 0.75, A: 0.75},
+			},
+			want: exr.RGBAColor{R: 0.6875, G: 0.25, A: 0.9375},
+		},
+		{
+			name: "samples at the same depth",
+			samples: []exr.DeepSample{
+				{Z: 1, ZBack: 1, R: 0.5, A: 0.5},
+				{Z: 1, ZBack: 1, G: 0.5, A: 0.5},
+			},
+			want: exr.RGBAColor{R: 0.375, G: 0.375, A: 0.75},
+		},
+		{
+			name: "opaque sample in front",
+			samples: []exr.DeepSample{
+				{Z: 2, ZBack: 2, R: 1, A: 1},
+				{Z: 1, ZBack: 1, B: 1, A: 1},
+			},
+			want: exr.RGBAColor{B: 1, A: 1},
+		},
+	}
+
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: int32(len(testCases) - 1), YMax: 0}
+	img := &testImage{
+		header: newTestHeader(dataWindow, dataWindow,
+			newTestChannel("A", internal.PixelTypeFloat),
+			newTestChannel("B", internal.PixelTypeFloat),
+			newTestChannel("G", internal.PixelTypeFloat),
+			newTestChannel("R", internal.PixelTypeFloat),
+			newTestChannel("Z", internal.PixelTypeFloat),
+			newTestChannel("ZBack", internal.PixelTypeFloat),
+		),
+	}
+	img.header.Type = internal.PartTypeDeepScanLine
+	count := func(x, y int32) int {
+		return len(testCases[x].samples)
+	}
+	value := func(channel int, x, y int32, sample int) float32 {
+		s := testCases[x].samples[sample]
+		return [...]float32{s.A, s.B, s.G, s.R, s.Z, s.ZBack}[channel]
+	}
+	table, samples := deepBlockData(img.header.Channels, dataWindow, count, value)
+	img.chunks = []testChunk{{data: deepScanLineChunk(0, deepChunkData(table, samples, len(samples)))}}
+
+	deep, err := exr.DecodeDeep(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	flat := exr.Flatten(deep)
+	if want := image.Rect(0, 0, len(testCases), 1); flat.Bounds() != want {
+		t.Fatalf("got bounds %v, want %v", flat.Bounds(), want)
+	}
+	for x, tc := range testCases {
+		got := flat.At(x, 0).(exr.RGBAColor)
+		for i, pair := range [][2]float32{{got.R, tc.want.R}, {got.G, tc.want.G}, {got.B, tc.want.B}, {got.A, tc.want.A}} {
+			if math.Abs(float64(pair[0]-pair[1])) > 1e-6 {
+				t.Fatalf("%s: component %d: got %v, want %v", tc.name, i, got, tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package exr
+
+import (
+	"image"
+	"io"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+const (
+	// PixelTypeUint indicates 32-bit unsigned integer channel values.
+	PixelTypeUint PixelType = PixelType(exr.PixelTypeUint)
+
+	// PixelTypeHalf indicates 16-bit floating point channel values.
+	PixelTypeHalf PixelType = PixelType(exr.PixelTypeHalf)
+
+	// PixelTypeFloat indicates 32-bit floating point channel values.
+	PixelTypeFloat PixelType = PixelType(exr.PixelTypeFloat)
+)
+
+// PixelType represents the data type of the values of a channel.
+type PixelType int32
+
+// String returns the name of the pixel type.
+func (t PixelType) String() string {
+	return exr.PixelType(t).String()
+}
+
+// Channel describes a single channel of an EXR image.
+type Channel struct {
+
+	// Name holds the name of the channel (e.g. "R" or "diffuse.R").
+	Name string
+
+	// PixelType holds the data type of the values of the channel.
+	PixelType PixelType
+
+	// Linear indicates whether the values of the channel are perceptually
+	// linear.
+	Linear bool
+
+	// XSampling holds the horizontal distance between two samples of the
+	// channel, in pixels.
+	XSampling int
+
+	// YSampling holds the vertical distance between two samples of the
+	// channel, in pixels.
+	YSampling int
+}
+
+const (
+	// LineOrderIncreasingY indicates scan line blocks or tiles that are
+	// stored from top to bottom.
+	LineOrderIncreasingY LineOrder = LineOrder(exr.LineOrderIncreasingY)
+
+	// LineOrderDecreasingY indicates scan line blocks or tiles that are
+	// stored from bottom to top.
+	LineOrderDecreasingY LineOrder = LineOrder(exr.LineOrderDecreasingY)
+
+	// LineOrderRandomY indicates tiles that are stored in no particular
+	// order.
+	LineOrderRandomY LineOrder = LineOrder(exr.LineOrderRandomY)
+)
+
+// LineOrder represents the order in which the pixel data of an image is
+// stored.
+type LineOrder uint8
+
+// String returns the name of the line order.
+func (o LineOrder) String() string {
+	return exr.LineOrder(o).String()
+}
+
+const (
+	// LevelModeOne indicates a tiled image with a single resolution level.
+	LevelModeOne LevelMode = LevelMode(exr.LevelModeOne)
+
+	// LevelModeMipmap indicates a tiled image with mipmap levels, which
+	// are scaled down equally in both directions.
+	LevelModeMipmap LevelMode = LevelMode(exr.LevelModeMipmap)
+
+	// LevelModeRipmap indicates a tiled image with ripmap levels, which
+	// are scaled down independently in each direction.
+	LevelModeRipmap LevelMode = LevelMode(exr.LevelModeRipmap)
+)
+
+// LevelMode represents the resolution levels that a tiled image contains.
+type LevelMode uint8
+
+// String returns the name of the level mode.
+func (m LevelMode) String() string {
+	return exr.LevelMode(m).String()
+}
+
+const (
+	// RoundingModeDown indicates level sizes that are rounded down.
+	RoundingModeDown RoundingMode = RoundingMode(exr.RoundingModeDown)
+
+	// RoundingModeUp indicates level sizes that are rounded up.
+	RoundingModeUp RoundingMode = RoundingMode(exr.RoundingModeUp)
+)
+
+// RoundingMode represents the way in which the sizes of the resolution
+// levels of a tiled image are rounded.
+type RoundingMode uint8
+
+// String returns the name of the rounding mode.
+func (m RoundingMode) String() string {
+	return exr.RoundingMode(m).String()
+}
+
+// TileDescription describes the tiles of a tiled image.
+type TileDescription struct {
+
+	// XSize holds the width of a tile in pixels.
+	XSize int
+
+	// YSize holds the height of a tile in pixels.
+	YSize int
+
+	// LevelMode holds the resolution levels of the image.
+	LevelMode LevelMode
+
+	// RoundingMode holds the way in which the level sizes are rounded.
+	RoundingMode RoundingMode
+}
+
+// Header holds the attributes of a single part of an EXR image.
+//
+// The windows of the header are converted to image.Rectangle values, which,
+// unlike the windows in the image, exclude their maximum point.
+//
+// Optional standard attributes are nil when the part does not specify them
+// or when it specifies them with an unexpected attribute type.
+type Header struct {
+
+	// Channels holds the channels of the part, sorted by name.
+	Channels []Channel
+
+	// Compression holds the compression of the pixel data.
+	Compression Compression
+
+	// DataWindow holds the bounds of the pixels that are stored.
+	DataWindow image.Rectangle
+
+	// DisplayWindow holds the bounds of the image on the screen.
+	DisplayWindow image.Rectangle
+
+	// LineOrder holds the order in which the pixel data is stored.
+	LineOrder LineOrder
+
+	// PixelAspectRatio holds the ratio between the width and the height of
+	// a pixel when displayed.
+	PixelAspectRatio float32
+
+	// ScreenWindowCenter holds the center of the screen window, which is
+	// used for the perspective projection of the image.
+	ScreenWindowCenter V2f
+
+	// ScreenWindowWidth holds the width of the screen window, which is
+	// used for the perspective projection of the image.
+	ScreenWindowWidth float32
+
+	// Tiles holds the tile description of tiled parts. It is nil for all
+	// other parts.
+	Tiles *TileDescription
+
+	// Name holds the name of the part, which is required for multipart
+	// images.
+	Name string
+
+	// Type holds the type of the part.
+	Type PartType
+
+	// ChunkCount holds the number of chunks of the part, which is only
+	// specified by multipart images.
+	ChunkCount int
+
+	// View holds the name of the stereo view of the part.
+	View *string
+
+	// Version holds the version of the deep data of deep parts.
+	Version *int32
+
+	// MaxSamplesPerPixel holds the largest number of samples that a pixel
+	// of a deep part has.
+	MaxSamplesPerPixel *int32
+
+	// Chromaticities holds the primaries and the white point of the color
+	// space of the pixel data.
+	Chromaticities *Chromaticities
+
+	// WhiteLuminance holds the luminance, in candelas per square meter,
+	// of the RGB value (1, 1, 1).
+	WhiteLuminance *float32
+
+	// AdoptedNeutral holds the CIE xy coordinates of the color that is
+	// considered neutral when the image is viewed.
+	AdoptedNeutral *V2f
+
+	// RenderingTransform holds the name of the CTL rendering transform of
+	// the image.
+	RenderingTransform *string
+
+	// LookModTransform holds the name of the CTL look modification
+	// transform of the image.
+	LookModTransform *string
+
+	// XDensity holds the horizontal output density of the image, in pixels
+	// per inch.
+	XDensity *float32
+
+	// Owner holds the name of the owner of the image.
+	Owner *string
+
+	// Comments holds additional information about the image.
+	Comments *string
+
+	// CapDate holds the date when the image was created or captured, in
+	// the form "YYYY:MM:DD hh:mm:ss".
+	CapDate *string
+
+	// UTCOffset holds the offset, in seconds, of CapDate from UTC.
+	UTCOffset *float32
+
+	// Longitude holds the longitude, in degrees, where the image was
+	// captured.
+	Longitude *float32
+
+	// Latitude holds the latitude, in degrees, where the image was
+	// captured.
+	Latitude *float32
+
+	// Altitude holds the altitude, in meters, where the image was
+	// captured.
+	Altitude *float32
+
+	// Focus holds the distance, in meters, at which the camera was
+	// focused.
+	Focus *float32
+
+	// ExpTime holds the exposure time, in seconds.
+	ExpTime *float32
+
+	// Aperture holds the lens aperture, in f-stops.
+	Aperture *float32
+
+	// ISOSpeed holds the ISO speed of the film or image sensor.
+	ISOSpeed *float32
+
+	// EnvMap holds the type of environment map that the image represents.
+	EnvMap *EnvMap
+
+	// KeyCode holds the film frame identifier of the image.
+	KeyCode *KeyCode
+
+	// TimeCode holds the time code of the image.
+	TimeCode *TimeCode
+
+	// WrapModes holds the way in which texture lookups outside of the
+	// image are handled (e.g. "clamp" or "periodic").
+	WrapModes *string
+
+	// FramesPerSecond holds the playback frame rate of the image sequence
+	// that the image is part of.
+	FramesPerSecond *Rational
+
+	// MultiView holds the names of the views of a stereo image.
+	MultiView []string
+
+	// WorldToCamera holds the transformation from world space to the
+	// camera space of the image.
+	WorldToCamera *M44f
+
+	// WorldToNDC holds the transformation from world space to the
+	// normalized device coordinates of the image.
+	WorldToNDC *M44f
+
+	// DeepImageState holds the guarantees that a deep part makes about its
+	// samples.
+	DeepImageState *DeepImageState
+
+	// OriginalDataWindow holds the data window of the image before it was
+	// cropped.
+	OriginalDataWindow *image.Rectangle
+
+	// DWACompressionLevel holds the quality setting that was used for DWA
+	// compression.
+	DWACompressionLevel *float32
+
+	// Preview holds a small, low dynamic range version of the image.
+	Preview *image.NRGBA
+
+	// Attributes holds all the attributes of the part, including custom
+	// ones.
+	Attributes Attributes
+}
+
+// DecodeHeader returns the header of an EXR image without decoding the
+// entire image. For multipart images, the header of the first part is
+// returned.
+func DecodeHeader(in io.Reader) (Header, error) {
+	_, headers, err := readHeaders(in)
+	if err != nil {
+		return Header{}, err
+	}
+	return newHeader(headers[0]), nil
+}
+
+// DecodeHeaders returns the headers of all the parts of an EXR image
+// without decoding the entire image.
+//
+// The headers are returned in the order in which the parts are stored in
+// the image.
+func DecodeHeaders(in io.Reader) ([]Header, error) {
+	_, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Header, len(headers))
+	for i, header := range headers {
+		result[i] = newHeader(header)
+	}
+	return result, nil
+}
+
+func newHeader(header exr.Header) Header {
+	result := Header{
+		Channels:           newChannels(header.Channels),
+		Compression:        Compression(header.Compression),
+		DataWindow:         boxToRect(header.DataWindow),
+		DisplayWindow:      boxToRect(header.DisplayWindow),
+		LineOrder:          LineOrder(header.LineOrder),
+		PixelAspectRatio:   1.0,
+		ScreenWindowCenter: V2f{},
+		ScreenWindowWidth:  1.0,
+		Name:               header.Name,
+		Type:               PartType(header.Type),
+		ChunkCount:         int(header.ChunkCount),
+	}
+	if header.Type.IsTiled() {
+		tiles := newTileDescription(header.Tiles)
+		result.Tiles = &tiles
+	}
+
+	attributes := newAttributes(header)
+	result.Attributes = attributes
+
+	for name, value := range attributes {
+		switch exr.AttributeName(name) {
+		case exr.AttributeNamePixelAspectRatio:
+			setAttribute(&result.PixelAspectRatio, value)
+		case exr.AttributeNameScreenWindowCenter:
+			setAttribute(&result.ScreenWindowCenter, value)
+		case exr.AttributeNameScreenWindowWidth:
+			setAttribute(&result.ScreenWindowWidth, value)
+		case exr.AttributeNameView:
+			setOptionalAttribute(&result.View, value)
+		case exr.AttributeNameVersion:
+			setOptionalAttribute(&result.Version, value)
+		case exr.AttributeNameMaxSamplesPerPixel:
+			setOptionalAttribute(&result.MaxSamplesPerPixel, value)
+		case exr.AttributeNameChromaticities:
+			setOptionalAttribute(&result.Chromaticities, value)
+		case exr.AttributeNameWhiteLuminance:
+			setOptionalAttribute(&result.WhiteLuminance, value)
+		case exr.AttributeNameAdoptedNeutral:
+			setOptionalAttribute(&result.AdoptedNeutral, value)
+		case exr.AttributeNameRenderingTransform:
+			setOptionalAttribute(&result.RenderingTransform, value)
+		case exr.AttributeNameLookModTransform:
+			setOptionalAttribute(&result.LookModTransform, value)
+		case exr.AttributeNameXDensity:
+			setOptionalAttribute(&result.XDensity, value)
+		case exr.AttributeNameOwner:
+			setOptionalAttribute(&result.Owner, value)
+		case exr.AttributeNameComments:
+			setOptionalAttribute(&result.Comments, value)
+		case exr.AttributeNameCapDate:
+			setOptionalAttribute(&result.CapDate, value)
+		case exr.AttributeNameUTCOffset:
+			setOptionalAttribute(&result.UTCOffset, value)
+		case exr.AttributeNameLongitude:
+			setOptionalAttribute(&result.Longitude, value)
+		case exr.AttributeNameLatitude:
+			setOptionalAttribute(&result.Latitude, value)
+		case exr.AttributeNameAltitude:
+			setOptionalAttribute(&result.Altitude, value)
+		case exr.AttributeNameFocus:
+			setOptionalAttribute(&result.Focus, value)
+		case exr.AttributeNameExpTime:
+			setOptionalAttribute(&result.ExpTime, value)
+		case exr.AttributeNameAperture:
+			setOptionalAttribute(&result.Aperture, value)
+		case exr.AttributeNameISOSpeed:
+			setOptionalAttribute(&result.ISOSpeed, value)
+		case exr.AttributeNameEnvMap:
+			setOptionalAttribute(&result.EnvMap, value)
+		case exr.AttributeNameKeyCode:
+			setOptionalAttribute(&result.KeyCode, value)
+		case exr.AttributeNameTimeCode:
+			setOptionalAttribute(&result.TimeCode, value)
+		case exr.AttributeNameWrapModes:
+			setOptionalAttribute(&result.WrapModes, value)
+		case exr.AttributeNameFramesPerSecond:
+			setOptionalAttribute(&result.FramesPerSecond, value)
+		case exr.AttributeNameMultiView:
+			setAttribute(&result.MultiView, value)
+		case exr.AttributeNameWorldToCamera:
+			setOptionalAttribute(&result.WorldToCamera, value)
+		case exr.AttributeNameWorldToNDC:
+			setOptionalAttribute(&result.WorldToNDC, value)
+		case exr.AttributeNameDeepImageState:
+			setOptionalAttribute(&result.DeepImageState, value)
+		case exr.AttributeNameOriginalDataWindow:
+			setOptionalAttribute(&result.OriginalDataWindow, value)
+		case exr.AttributeNameDWACompressionLevel:
+			setOptionalAttribute(&result.DWACompressionLevel, value)
+		case exr.AttributeNamePreview:
+			setAttribute(&result.Preview, value)
+		}
+	}
+	return result
+}
+
+func newChannels(channels exr.ChannelList) []Channel {
+	result := make([]Channel, len(channels))
+	for i, channel := range channels {
+		result[i] = Channel{
+			Name:      channel.Name,
+			PixelType: PixelType(channel.PixelType),
+			Linear:    channel.Linear,
+			XSampling: int(channel.XSampling),
+			YSampling: int(channel.YSampling),
+		}
+	}
+	return result
+}
+
+func newTileDescription(tiles exr.TileDescription) TileDescription {
+	return TileDescription{
+		XSize:        int(tiles.XSize),
+		YSize:        int(tiles.YSize),
+		LevelMode:    LevelMode(tiles.LevelMode),
+		RoundingMode: RoundingMode(tiles.RoundingMode),
+	}
+}
+
+// setAttribute assigns value to target, provided that it has the type of
+// target. Values of a different type are ignored.
+func setAttribute[T any](target *T, value any) {
+	if value, ok := value.(T); ok {
+		*target = value
+	}
+}
+
+// setOptionalAttribute assigns a pointer to value to target, provided that
+// it has the type that target points to. Values of a different type are
+// ignored.
+func setOptionalAttribute[T any](target **T, value any) {
+	if value, ok := value.(T); ok {
+		*target = &value
+	}
+}
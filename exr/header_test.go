@@ -0,0 +1,243 @@
+package exr_test
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestDecodeHeader(t *testing.T) {
+	dataWindow := internal.Box2i{XMin: -1, YMin: 2, XMax: 8, YMax: 6}
+	displayWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 9, YMax: 9}
+	img := &testImage{
+		header: newTestHeader(dataWindow, displayWindow,
+			internal.Channel{Name: "Y", PixelType: internal.PixelTypeHalf, Linear: true, XSampling: 1, YSampling: 1},
+			newTestChannel("Z", internal.PixelTypeFloat),
+			newTestChannel("id", internal.PixelTypeUint),
+		),
+	}
+	img.header.Type = internal.PartTypeTiled
+	img.header.Compression = internal.CompressionZIP
+	img.header.LineOrder = internal.LineOrderDecreasingY
+	img.header.Tiles = internal.TileDescription{
+		XSize:        4,
+		YSize:        3,
+		LevelMode:    internal.LevelModeMipmap,
+		RoundingMode: internal.RoundingModeUp,
+	}
+
+	chromaticities := exr.Chromaticities{
+		Red:   exr.V2f{X: 0.64, Y: 0.33},
+		Green: exr.V2f{X: 0.3, Y: 0.6},
+		Blue:  exr.V2f{X: 0.15, Y: 0.06},
+		White: exr.V2f{X: 0.3127, Y: 0.329},
+	}
+	keyCode := exr.KeyCode{FilmMfcCode: 1, FilmType: 2, Prefix: 3, Count: 4, PerfOffset: 5, PerfsPerFrame: 6, PerfsPerCount: 20}
+	timeCode := exr.TimeCode{TimeAndFlags: 0x01020304, UserData: 0x05060708}
+	worldToCamera := exr.M44f{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {1, 2, 3, 1}}
+	worldToNDC := exr.M44f{{2, 0, 0, 0}, {0, 2, 0, 0}, {0, 0, -1, -1}, {0, 0, -2, 0}}
+	preview := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	copy(preview.Pix, []byte{255, 0, 0, 255, 0, 128, 255, 64})
+
+	img.header.Attributes = []internal.Attribute{
+		testAttribute(t, "pixelAspectRatio", internal.AttributeTypeFloat, float32(2)),
+		testAttribute(t, "screenWindowCenter", internal.AttributeTypeV2f, exr.V2f{X: 0.5, Y: -0.5}),
+		testAttribute(t, "screenWindowWidth", internal.AttributeTypeFloat, float32(3)),
+		testAttribute(t, "view", internal.AttributeTypeString, []byte("left")),
+		testAttribute(t, "version", internal.AttributeTypeInt, int32(1)),
+		testAttribute(t, "maxSamplesPerPixel", internal.AttributeTypeInt, int32(12)),
+		testAttribute(t, "chromaticities", internal.AttributeTypeChromaticities, chromaticities),
+		testAttribute(t, "whiteLuminance", internal.AttributeTypeFloat, float32(100)),
+		testAttribute(t, "adoptedNeutral", internal.AttributeTypeV2f, exr.V2f{X: 0.3127, Y: 0.329}),
+		testAttribute(t, "renderingTransform", internal.AttributeTypeString, []byte("rrt")),
+		testAttribute(t, "lookModTransform", internal.AttributeTypeString, []byte("lmt")),
+		testAttribute(t, "xDensity", internal.AttributeTypeFloat, float32(72)),
+		testAttribute(t, "owner", internal.AttributeTypeString, []byte("studio")),
+		testAttribute(t, "comments", internal.AttributeTypeString, []byte("final render")),
+		testAttribute(t, "capDate", internal.AttributeTypeString, []byte("2024:01:02 03:04:05")),
+		testAttribute(t, "utcOffset", internal.AttributeTypeFloat, float32(-3600)),
+		testAttribute(t, "longitude", internal.AttributeTypeFloat, float32(13.4)),
+		testAttribute(t, "latitude", internal.AttributeTypeFloat, float32(52.5)),
+		testAttribute(t, "altitude", internal.AttributeTypeFloat, float32(34)),
+		testAttribute(t, "focus", internal.AttributeTypeFloat, float32(2.5)),
+		testAttribute(t, "expTime", internal.AttributeTypeFloat, float32(0.02)),
+		testAttribute(t, "aperture", internal.AttributeTypeFloat, float32(2.8)),
+		testAttribute(t, "isoSpeed", internal.AttributeTypeFloat, float32(400)),
+		testAttribute(t, "envmap", internal.AttributeTypeEnvMap, exr.EnvMapCube),
+		testAttribute(t, "keyCode", internal.AttributeTypeKeyCode, keyCode),
+		testAttribute(t, "timeCode", internal.AttributeTypeTimeCode, timeCode),
+		testAttribute(t, "wrapmodes", internal.AttributeTypeString, []byte("clamp,periodic")),
+		testAttribute(t, "framesPerSecond", internal.AttributeTypeRational, exr.Rational{Numerator: 24000, Denominator: 1001}),
+		testAttribute(t, "multiView", internal.AttributeTypeStringVector, int32(4), []byte("left"), int32(5), []byte("right")),
+		testAttribute(t, "worldToCamera", internal.AttributeTypeM44f, worldToCamera),
+		testAttribute(t, "worldToNDC", internal.AttributeTypeM44f, worldToNDC),
+		testAttribute(t, "deepImageState", internal.AttributeTypeDeepImageState, exr.DeepImageStateTidy),
+		testAttribute(t, "originalDataWindow", internal.AttributeTypeBox2i, internal.Box2i{XMin: -5, YMin: -5, XMax: 14, YMax: 14}),
+		testAttribute(t, "dwaCompressionLevel", internal.AttributeTypeFloat, float32(45)),
+		testAttribute(t, "preview", internal.AttributeTypePreview, uint32(2), uint32(1), preview.Pix),
+	}
+
+	originalDataWindow := image.Rect(-5, -5, 15, 15)
+	want := exr.Header{
+		Channels: []exr.Channel{
+			{Name: "Y", PixelType: exr.PixelTypeHalf, Linear: true, XSampling: 1, YSampling: 1},
+			{Name: "Z", PixelType: exr.PixelTypeFloat, XSampling: 1, YSampling: 1},
+			{Name: "id", PixelType: exr.PixelTypeUint, XSampling: 1, YSampling: 1},
+		},
+		Compression:        exr.CompressionZIP,
+		DataWindow:         image.Rect(-1, 2, 9, 7),
+		DisplayWindow:      image.Rect(0, 0, 10, 10),
+		LineOrder:          exr.LineOrderDecreasingY,
+		PixelAspectRatio:   2,
+		ScreenWindowCenter: exr.V2f{X: 0.5, Y: -0.5},
+		ScreenWindowWidth:  3,
+		Tiles: &exr.TileDescription{
+			XSize:        4,
+			YSize:        3,
+			LevelMode:    exr.LevelModeMipmap,
+			RoundingMode: exr.RoundingModeUp,
+		},
+		Type:                exr.PartTypeTiled,
+		View:                ptr("left"),
+		Version:             ptr(int32(1)),
+		MaxSamplesPerPixel:  ptr(int32(12)),
+		Chromaticities:      &chromaticities,
+		WhiteLuminance:      ptr(float32(100)),
+		AdoptedNeutral:      &exr.V2f{X: 0.3127, Y: 0.329},
+		RenderingTransform:  ptr("rrt"),
+		LookModTransform:    ptr("lmt"),
+		XDensity:            ptr(float32(72)),
+		Owner:               ptr("studio"),
+		Comments:            ptr("final render"),
+		CapDate:             ptr("2024:01:02 03:04:05"),
+		UTCOffset:           ptr(float32(-3600)),
+		Longitude:           ptr(float32(13.4)),
+		Latitude:            ptr(float32(52.5)),
+		Altitude:            ptr(float32(34)),
+		Focus:               ptr(float32(2.5)),
+		ExpTime:             ptr(float32(0.02)),
+		Aperture:            ptr(float32(2.8)),
+		ISOSpeed:            ptr(float32(400)),
+		EnvMap:              ptr(exr.EnvMapCube),
+		KeyCode:             &keyCode,
+		TimeCode:            &timeCode,
+		WrapModes:           ptr("clamp,periodic"),
+		FramesPerSecond:     &exr.Rational{Numerator: 24000, Denominator: 1001},
+		MultiView:           []string{"left", "right"},
+		WorldToCamera:       &worldToCamera,
+		WorldToNDC:          &worldToNDC,
+		DeepImageState:      ptr(exr.DeepImageStateTidy),
+		OriginalDataWindow:  &originalDataWindow,
+		DWACompressionLevel: ptr(float32(45)),
+		Preview:             preview,
+	}
+
+	header, err := exr.DecodeHeader(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	// The attributes are checked by the attribute tests.
+	if len(header.Attributes) != 6+len(img.header.Attributes) {
+		t.Fatalf("got %d attributes, want %d", len(header.Attributes), 6+len(img.header.Attributes))
+	}
+	header.Attributes = nil
+	if !reflect.DeepEqual(header, want) {
+		t.Fatalf("got header %+v, want %+v", header, want)
+	}
+}
+
+func TestDecodeHeaderDefaults(t *testing.T) {
+	window := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 3}
+	img := &testImage{
+		header: newTestHeader(window, window, newTestChannel("R", internal.PixelTypeHalf)),
+	}
+	// Standard attributes with an unexpected type are ignored.
+	img.header.Attributes = []internal.Attribute{
+		testAttribute(t, "pixelAspectRatio", internal.AttributeTypeDouble, float64(2)),
+		testAttribute(t, "owner", internal.AttributeTypeInt, int32(7)),
+	}
+
+	header, err := exr.DecodeHeader(bytes.NewReader(img.bytes(t)))
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	if value, ok := exr.AttributeValue[int32](header.Attributes, "owner"); !ok || value != 7 {
+		t.Fatalf("got owner attribute %v, want 7", header.Attributes["owner"])
+	}
+	header.Attributes = nil
+	want := exr.Header{
+		Channels:          []exr.Channel{{Name: "R", PixelType: exr.PixelTypeHalf, XSampling: 1, YSampling: 1}},
+		Compression:       exr.CompressionNone,
+		DataWindow:        image.Rect(0, 0, 4, 4),
+		DisplayWindow:     image.Rect(0, 0, 4, 4),
+		LineOrder:         exr.LineOrderIncreasingY,
+		PixelAspectRatio:  1,
+		ScreenWindowWidth: 1,
+		Type:              exr.PartTypeScanLine,
+	}
+	if !reflect.DeepEqual(header, want) {
+		t.Fatalf("got header %+v, want %+v", header, want)
+	}
+}
+
+func TestDecodeHeaders(t *testing.T) {
+	img, _ := newTestMultipartImage(t)
+	data := img.bytes(t)
+
+	headers, err := exr.DecodeHeaders(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding headers: %v", err)
+	}
+	want := []struct {
+		name       string
+		partType   exr.PartType
+		chunkCount int
+		dataWindow image.Rectangle
+		tiles      *exr.TileDescription
+	}{
+		{name: "beauty", partType: exr.PartTypeScanLine, chunkCount: 3, dataWindow: image.Rect(0, 0, 4, 3)},
+		{
+			name:       "depth",
+			partType:   exr.PartTypeTiled,
+			chunkCount: 6,
+			dataWindow: image.Rect(0, 0, 5, 4),
+			tiles:      &exr.TileDescription{XSize: 2, YSize: 2, LevelMode: exr.LevelModeOne, RoundingMode: exr.RoundingModeDown},
+		},
+		{name: "aov", partType: exr.PartTypeScanLine, chunkCount: 4, dataWindow: image.Rect(1, 1, 3, 5)},
+	}
+	if len(headers) != len(want) {
+		t.Fatalf("got %d headers, want %d", len(headers), len(want))
+	}
+	for i, header := range headers {
+		if header.Name != want[i].name || header.Type != want[i].partType || header.ChunkCount != want[i].chunkCount {
+			t.Fatalf("header %d: got part %q (%v, %d chunks), want %q (%v, %d chunks)",
+				i, header.Name, header.Type, header.ChunkCount, want[i].name, want[i].partType, want[i].chunkCount)
+		}
+		if header.DataWindow != want[i].dataWindow || header.DisplayWindow != image.Rect(0, 0, 5, 5) {
+			t.Fatalf("header %d: got windows %v and %v", i, header.DataWindow, header.DisplayWindow)
+		}
+		if !reflect.DeepEqual(header.Tiles, want[i].tiles) {
+			t.Fatalf("header %d: got tiles %+v, want %+v", i, header.Tiles, want[i].tiles)
+		}
+		if value, ok := exr.AttributeValue[string](header.Attributes, "name"); !ok || value != want[i].name {
+			t.Fatalf("header %d: got name attribute %v", i, header.Attributes["name"])
+		}
+	}
+
+	header, err := exr.DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	if !reflect.DeepEqual(header, headers[0]) {
+		t.Fatalf("got header %+v, want the header of the first part %+v", header, headers[0])
+	}
+}
+
+// ptr returns a pointer to a copy of value.
+func ptr[T any](value T) *T {
+	return &value
+}
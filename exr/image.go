@@ -17,6 +17,13 @@ type RGBAImage struct {
 	channelG exr.PixelData
 	channelB exr.PixelData
 	channelA exr.PixelData
+
+	attributes Attributes
+}
+
+// Attributes returns the attributes of the image, including custom ones.
+func (i *RGBAImage) Attributes() Attributes {
+	return i.attributes
 }
 
 // ColorModel returns the RGBAImage's color model.
@@ -1,20 +1,59 @@
 package exr
 
-import "io"
+import (
+	"fmt"
+	"io"
+)
 
 func ReadAttributeName(in io.Reader, target *AttributeName) error {
 	return ReadNullTerminatedString(in, target)
 }
 
 const (
-	AttributeNameChannels           AttributeName = "channels"
-	AttributeNameCompression        AttributeName = "compression"
-	AttributeNameDataWindow         AttributeName = "dataWindow"
-	AttributeNameDisplayWindow      AttributeName = "displayWindow"
-	AttributeNameLineOrder          AttributeName = "lineOrder"
-	AttributeNamePixelAspectRatio   AttributeName = "pixelAspectRatio"
-	AttributeNameScreenWindowCenter AttributeName = "screenWindowCenter"
-	AttributeNameScreenWindowWidth  AttributeName = "screenWindowWidth"
+	AttributeNameChannels            AttributeName = "channels"
+	AttributeNameCompression         AttributeName = "compression"
+	AttributeNameDataWindow          AttributeName = "dataWindow"
+	AttributeNameDisplayWindow       AttributeName = "displayWindow"
+	AttributeNameLineOrder           AttributeName = "lineOrder"
+	AttributeNamePixelAspectRatio    AttributeName = "pixelAspectRatio"
+	AttributeNameScreenWindowCenter  AttributeName = "screenWindowCenter"
+	AttributeNameScreenWindowWidth   AttributeName = "screenWindowWidth"
+	AttributeNameTiles               AttributeName = "tiles"
+	AttributeNameName                AttributeName = "name"
+	AttributeNameType                AttributeName = "type"
+	AttributeNameChunkCount          AttributeName = "chunkCount"
+	AttributeNameVersion             AttributeName = "version"
+	AttributeNameView                AttributeName = "view"
+	AttributeNameMaxSamplesPerPixel  AttributeName = "maxSamplesPerPixel"
+	AttributeNameChromaticities      AttributeName = "chromaticities"
+	AttributeNameWhiteLuminance      AttributeName = "whiteLuminance"
+	AttributeNameAdoptedNeutral      AttributeName = "adoptedNeutral"
+	AttributeNameRenderingTransform  AttributeName = "renderingTransform"
+	AttributeNameLookModTransform    AttributeName = "lookModTransform"
+	AttributeNameXDensity            AttributeName = "xDensity"
+	AttributeNameOwner               AttributeName = "owner"
+	AttributeNameComments            AttributeName = "comments"
+	AttributeNameCapDate             AttributeName = "capDate"
+	AttributeNameUTCOffset           AttributeName = "utcOffset"
+	AttributeNameLongitude           AttributeName = "longitude"
+	AttributeNameLatitude            AttributeName = "latitude"
+	AttributeNameAltitude            AttributeName = "altitude"
+	AttributeNameFocus               AttributeName = "focus"
+	AttributeNameExpTime             AttributeName = "expTime"
+	AttributeNameAperture            AttributeName = "aperture"
+	AttributeNameISOSpeed            AttributeName = "isoSpeed"
+	AttributeNameEnvMap              AttributeName = "envmap"
+	AttributeNameKeyCode             AttributeName = "keyCode"
+	AttributeNameTimeCode            AttributeName = "timeCode"
+	AttributeNameWrapModes           AttributeName = "wrapmodes"
+	AttributeNameFramesPerSecond     AttributeName = "framesPerSecond"
+	AttributeNameMultiView           AttributeName = "multiView"
+	AttributeNameWorldToCamera       AttributeName = "worldToCamera"
+	AttributeNameWorldToNDC          AttributeName = "worldToNDC"
+	AttributeNameDeepImageState      AttributeName = "deepImageState"
+	AttributeNameOriginalDataWindow  AttributeName = "originalDataWindow"
+	AttributeNameDWACompressionLevel AttributeName = "dwaCompressionLevel"
+	AttributeNamePreview             AttributeName = "preview"
 )
 
 type AttributeName string
@@ -24,12 +63,60 @@ func ReadAttributeType(in io.Reader, target *AttributeType) error {
 }
 
 const (
-	AttributeTypeChannelList AttributeType = "chlist"
-	AttributeTypeCompression AttributeType = "compression"
-	AttributeTypeBox2i       AttributeType = "box2i"
-	AttributeTypeLineOrder   AttributeType = "lineOrder"
-	AttributeTypeFloat       AttributeType = "float"
-	AttributeTypeV2f         AttributeType = "v2f"
+	AttributeTypeChannelList    AttributeType = "chlist"
+	AttributeTypeCompression    AttributeType = "compression"
+	AttributeTypeBox2i          AttributeType = "box2i"
+	AttributeTypeLineOrder      AttributeType = "lineOrder"
+	AttributeTypeFloat          AttributeType = "float"
+	AttributeTypeV2f            AttributeType = "v2f"
+	AttributeTypeTileDesc       AttributeType = "tiledesc"
+	AttributeTypeString         AttributeType = "string"
+	AttributeTypeInt            AttributeType = "int"
+	AttributeTypeStringVector   AttributeType = "stringvector"
+	AttributeTypeM44f           AttributeType = "m44f"
+	AttributeTypeRational       AttributeType = "rational"
+	AttributeTypeTimeCode       AttributeType = "timecode"
+	AttributeTypeKeyCode        AttributeType = "keycode"
+	AttributeTypeChromaticities AttributeType = "chromaticities"
+	AttributeTypeEnvMap         AttributeType = "envmap"
+	AttributeTypeDeepImageState AttributeType = "deepImageState"
+	AttributeTypePreview        AttributeType = "preview"
+	AttributeTypeDouble         AttributeType = "double"
+	AttributeTypeFloatVector    AttributeType = "floatvector"
+	AttributeTypeV2i            AttributeType = "v2i"
+	AttributeTypeV3i            AttributeType = "v3i"
+	AttributeTypeV3f            AttributeType = "v3f"
+	AttributeTypeV2d            AttributeType = "v2d"
+	AttributeTypeV3d            AttributeType = "v3d"
+	AttributeTypeBox2f          AttributeType = "box2f"
+	AttributeTypeM33f           AttributeType = "m33f"
+	AttributeTypeM33d           AttributeType = "m33d"
+	AttributeTypeM44d           AttributeType = "m44d"
 )
 
 type AttributeType string
+
+// Attribute holds the raw value of an attribute, as it is stored in the
+// header.
+type Attribute struct {
+	Name  AttributeName
+	Type  AttributeType
+	Value []byte
+}
+
+// WriteAttribute writes the name, type, size and value of an attribute.
+func WriteAttribute(out io.Writer, attribute Attribute) error {
+	if err := WriteNullTerminatedString(out, attribute.Name); err != nil {
+		return fmt.Errorf("error writing attribute name: %w", err)
+	}
+	if err := WriteNullTerminatedString(out, attribute.Type); err != nil {
+		return fmt.Errorf("error writing attribute type: %w", err)
+	}
+	if err := Write(out, int32(len(attribute.Value))); err != nil {
+		return fmt.Errorf("error writing attribute size: %w", err)
+	}
+	if _, err := out.Write(attribute.Value); err != nil {
+		return fmt.Errorf("error writing attribute value: %w", err)
+	}
+	return nil
+}
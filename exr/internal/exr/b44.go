@@ -0,0 +1,190 @@
+package exr
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/x448/float16"
+)
+
+// NewB44Decompressor returns a Decompressor for both the B44 and the B44A
+// compressions, since the latter only adds an encoding for flat blocks that
+// the decoder can distinguish on its own.
+func NewB44Decompressor(channels ChannelList) Decompressor {
+	return &b44Decompressor{
+		channels: channels,
+	}
+}
+
+type b44Decompressor struct {
+	channels ChannelList
+}
+
+type b44ChannelData struct {
+	start     int
+	nx        int
+	ny        int
+	ys        int32
+	size      int
+	pixelType PixelType
+	linear    bool
+}
+
+func (d *b44Decompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
+	channelData := make([]b44ChannelData, len(d.channels))
+	valueCount := 0
+	for i, channel := range d.channels {
+		cd := &channelData[i]
+		cd.start = valueCount
+		cd.nx = int(NumSamples(channel.XSampling, block.XMin, block.XMax))
+		cd.ny = int(NumSamples(channel.YSampling, block.YMin, block.YMax))
+		cd.ys = channel.YSampling
+		cd.size = channel.PixelType.ByteSize() / PixelTypeHalf.ByteSize()
+		cd.pixelType = channel.PixelType
+		cd.linear = channel.Linear
+		valueCount += cd.nx * cd.ny * cd.size
+	}
+
+	in := src.Bytes()
+	values := make([]uint16, valueCount)
+	for _, cd := range channelData {
+		if cd.pixelType != PixelTypeHalf {
+			// UINT and FLOAT channels are stored uncompressed.
+			count := cd.nx * cd.ny * cd.size
+			if len(in) < count*2 {
+				return nil, fmt.Errorf("b44 data too short")
+			}
+			for i := 0; i < count; i++ {
+				values[cd.start+i] = order.Uint16(in[i*2:])
+			}
+			in = in[count*2:]
+			continue
+		}
+
+		var s [16]uint16
+		for y := 0; y < cd.ny; y += 4 {
+			for x := 0; x < cd.nx; x += 4 {
+				if len(in) < 3 {
+					return nil, fmt.Errorf("b44 data too short")
+				}
+				if in[2] >= (13 << 2) {
+					b44Unpack3(in, &s)
+					in = in[3:]
+				} else {
+					if len(in) < 14 {
+						return nil, fmt.Errorf("b44 data too short")
+					}
+					b44Unpack14(in, &s)
+					in = in[14:]
+				}
+				if cd.linear {
+					b44ConvertToLinear(&s)
+				}
+				for by := 0; by < 4 && y+by < cd.ny; by++ {
+					for bx := 0; bx < 4 && x+bx < cd.nx; bx++ {
+						values[cd.start+(y+by)*cd.nx+x+bx] = s[by*4+bx]
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]byte, 2*valueCount)
+	offset := 0
+	for y := block.YMin; y <= block.YMax; y++ {
+		for i := range channelData {
+			cd := &channelData[i]
+			if Mod(y, cd.ys) != 0 {
+				continue
+			}
+			count := cd.nx * cd.size
+			for _, value := range values[cd.start : cd.start+count] {
+				order.PutUint16(out[offset:], value)
+				offset += 2
+			}
+			cd.start += count
+		}
+	}
+	return bytes.NewBuffer(out), nil
+}
+
+// b44Unpack14 unpacks a 4x4 block of half values that has been packed into
+// 14 bytes.
+func b44Unpack14(b []byte, s *[16]uint16) {
+	shift := b[2] >> 2
+	bias := uint16(0x20) << shift
+	delta := func(v byte) uint16 {
+		return uint16(v&0x3f)<<shift - bias
+	}
+
+	s[0] = uint16(b[0])<<8 | uint16(b[1])
+	s[4] = s[0] + delta(b[2]<<4|b[3]>>4)
+	s[8] = s[4] + delta(b[3]<<2|b[4]>>6)
+	s[12] = s[8] + delta(b[4])
+	s[1] = s[0] + delta(b[5]>>2)
+	s[5] = s[4] + delta(b[5]<<4|b[6]>>4)
+	s[9] = s[8] + delta(b[6]<<2|b[7]>>6)
+	s[13] = s[12] + delta(b[7])
+	s[2] = s[1] + delta(b[8]>>2)
+	s[6] = s[5] + delta(b[8]<<4|b[9]>>4)
+	s[10] = s[9] + delta(b[9]<<2|b[10]>>6)
+	s[14] = s[13] + delta(b[10])
+	s[3] = s[2] + delta(b[11]>>2)
+	s[7] = s[6] + delta(b[11]<<4|b[12]>>4)
+	s[11] = s[10] + delta(b[12]<<2|b[13]>>6)
+	s[15] = s[14] + delta(b[13])
+
+	for i := range s {
+		s[i] = b44FromOrdered(s[i])
+	}
+}
+
+// b44Unpack3 unpacks a 4x4 block of equal half values that has been packed
+// into 3 bytes.
+func b44Unpack3(b []byte, s *[16]uint16) {
+	value := b44FromOrdered(uint16(b[0])<<8 | uint16(b[1]))
+	for i := range s {
+		s[i] = value
+	}
+}
+
+// b44FromOrdered converts a value from the ordered representation used by
+// B44, where larger numbers correspond to larger half values, back to the
+// half bit representation.
+func b44FromOrdered(v uint16) uint16 {
+	if v&0x8000 != 0 {
+		return v & 0x7fff
+	}
+	return ^v
+}
+
+var (
+	b44ExpTableOnce sync.Once
+	b44ExpTable     []uint16
+)
+
+// b44ConvertToLinear converts the half values of a perceptually linear
+// (p-linear) channel from the logarithmic space that they are compressed in
+// back to linear space.
+func b44ConvertToLinear(s *[16]uint16) {
+	b44ExpTableOnce.Do(func() {
+		maxValue := 8 * math.Log(float64(float16.Frombits(0x7bff).Float32()))
+		b44ExpTable = make([]uint16, 1<<16)
+		for i := range b44ExpTable {
+			h := float16.Frombits(uint16(i))
+			switch {
+			case h.IsInf(0) || h.IsNaN():
+				b44ExpTable[i] = 0
+			case float64(h.Float32()) >= maxValue:
+				b44ExpTable[i] = 0x7bff
+			default:
+				b44ExpTable[i] = float16.Fromfloat32(float32(math.Exp(float64(h.Float32() / 8)))).Bits()
+			}
+		}
+	})
+	for i := range s {
+		s[i] = b44ExpTable[s[i]]
+	}
+}
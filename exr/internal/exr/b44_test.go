@@ -0,0 +1,117 @@
+package exr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestB44Decompress(t *testing.T) {
+	channels := ChannelList{
+		testChannel("Y", PixelTypeHalf, 1, 1),
+		testChannel("Z", PixelTypeFloat, 1, 1),
+		testChannel("id", PixelTypeUint, 1, 1),
+	}
+
+	// The block is 6x5 pixels, so the HALF channel is split into four 4x4
+	// blocks, three of which only partly cover the block.
+	block := Box2i{XMin: 10, YMin: 20, XMax: 15, YMax: 24}
+	halfBlocks := [][]byte{
+		// The first value is 1.0 (0x3c00) in the ordered form 0xbc00. The
+		// shift is 0, so the six-bit differences are biased by 0x20 and
+		// every row adds 1 (0x21) and every column 2 (0x22).
+		{0xbc, 0x00, 0x02, 0x18, 0x61, 0x8a, 0x28, 0xa2, 0x8a, 0x28, 0xa2, 0x8a, 0x28, 0xa2},
+		// A flat block of 0.5 (0x3800), with 0xfc marking it as such.
+		{0xb8, 0x00, 0xfc},
+		// The first value is -2.0 (0xc000) in the ordered form 0x3fff. The
+		// shift is 1, so every row adds 2 * 0x1f - 0x40 = -2 to the ordered
+		// value and every column 2 * 0x20 - 0x40 = 0.
+		{0x3f, 0xff, 0x05, 0xf7, 0xdf, 0x82, 0x08, 0x20, 0x82, 0x08, 0x20, 0x82, 0x08, 0x20},
+		// A flat block of -0.0 (0x8000) in the ordered form 0x7fff.
+		{0x7f, 0xff, 0xfc},
+	}
+	halfValue := func(x, y int) uint16 {
+		switch {
+		case x < 4 && y < 4:
+			return 0x3c00 + uint16(y+2*x)
+		case y < 4:
+			return 0x3800
+		case x < 4:
+			return 0xc000 + uint16(2*(y-4))
+		default:
+			return 0x8000
+		}
+	}
+
+	compressed := &bytes.Buffer{}
+	for _, data := range halfBlocks {
+		compressed.Write(data)
+	}
+	// FLOAT and UINT channels are stored uncompressed, one channel after
+	// the other.
+	for i := 0; i < 30; i++ {
+		Write(compressed, float32(i)*0.75)
+	}
+	for i := 0; i < 30; i++ {
+		Write(compressed, uint32(i*1000))
+	}
+
+	want := &bytes.Buffer{}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 6; x++ {
+			Write(want, halfValue(x, y))
+		}
+		for x := 0; x < 6; x++ {
+			Write(want, float32(y*6+x)*0.75)
+		}
+		for x := 0; x < 6; x++ {
+			Write(want, uint32((y*6+x)*1000))
+		}
+	}
+
+	buffer, err := NewB44Decompressor(channels).Decompress(compressed, block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), want.Bytes()) {
+		t.Fatalf("got % x, want % x", buffer.Bytes(), want.Bytes())
+	}
+}
+
+func TestB44DecompressLinear(t *testing.T) {
+	channel := testChannel("Y", PixelTypeHalf, 1, 1)
+	channel.Linear = true
+	channels := ChannelList{channel}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 15, YMax: 3}
+
+	// The values of p-linear channels are stored as 8 * ln(value), so they
+	// are converted back with exp(value / 8), where values that would be
+	// too large for a half become the largest half value and infinite ones
+	// become zero.
+	compressed := bytes.NewBuffer([]byte{
+		// A flat block of 0.0 (0x0000), which is exp(0 / 8) = 1.0 (0x3c00).
+		0x80, 0x00, 0xfc,
+		// A flat block of 65504 (0x7bff), which is clamped to 65504.
+		0xfb, 0xff, 0xfc,
+		// A flat block of infinity (0x7c00), which becomes 0.0.
+		0xfc, 0x00, 0xfc,
+		// A flat block of 5.546875 (0x458c), which is close to 8 * ln(2), so
+		// exp(5.546875 / 8) rounds to 2.0 (0x4000).
+		0xc5, 0x8c, 0xfc,
+	})
+	want := &bytes.Buffer{}
+	for y := 0; y < 4; y++ {
+		for _, value := range []uint16{0x3c00, 0x7bff, 0x0000, 0x4000} {
+			for x := 0; x < 4; x++ {
+				Write(want, value)
+			}
+		}
+	}
+
+	buffer, err := NewB44Decompressor(channels).Decompress(compressed, block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), want.Bytes()) {
+		t.Fatalf("got % x, want % x", buffer.Bytes(), want.Bytes())
+	}
+}
@@ -0,0 +1,38 @@
+package exr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// DecompressBlock returns the uncompressed pixel data of the specified
+// block. The data is only decompressed if it is smaller than the size of the
+// uncompressed block, since otherwise it has been stored as is.
+func DecompressBlock(data []byte, block Box2i, channels ChannelList, decompressor Decompressor) (*bytes.Buffer, error) {
+	buffer := bytes.NewBuffer(data)
+	if channels.BlockSize(block) > len(data) {
+		var err error
+		buffer, err = decompressor.Decompress(buffer, block)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing block data: %w", err)
+		}
+	}
+	return buffer, nil
+}
+
+// ReadBlock reads the uncompressed pixel data of the specified block into
+// the data channels.
+func ReadBlock(in io.Reader, block Box2i, channels ChannelList, dataChannels []PixelData) error {
+	for y := block.YMin; y <= block.YMax; y++ {
+		for i, channel := range channels {
+			if Mod(y, channel.YSampling) != 0 {
+				continue
+			}
+			if err := dataChannels[i].ReadLine(in, block.XMin, block.XMax, y); err != nil {
+				return fmt.Errorf("error reading scan line: %w", err)
+			}
+		}
+	}
+	return nil
+}
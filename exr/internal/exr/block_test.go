@@ -0,0 +1,109 @@
+package exr
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/x448/float16"
+)
+
+// testBlockData returns the uncompressed pixel data of the specified block,
+// where value returns the value of the channel with the specified index at
+// the specified pixel.
+func testBlockData(channels ChannelList, block Box2i, value func(channel int, x, y int32) float32) []byte {
+	out := &bytes.Buffer{}
+	for y := block.YMin; y <= block.YMax; y++ {
+		for c, channel := range channels {
+			if Mod(y, channel.YSampling) != 0 {
+				continue
+			}
+			for x := block.XMin; x <= block.XMax; x++ {
+				if Mod(x, channel.XSampling) != 0 {
+					continue
+				}
+				v := value(c, x, y)
+				switch channel.PixelType {
+				case PixelTypeUint:
+					Write(out, uint32(v))
+				case PixelTypeHalf:
+					Write(out, float16.Fromfloat32(v).Bits())
+				default:
+					Write(out, v)
+				}
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// testChannel returns a channel with the specified name, pixel type and
+// sampling.
+func testChannel(name string, pixelType PixelType, xSampling, ySampling int32) Channel {
+	return Channel{
+		Name:      name,
+		PixelType: pixelType,
+		XSampling: xSampling,
+		YSampling: ySampling,
+	}
+}
+
+func TestDecompressBlockStoredAsIs(t *testing.T) {
+	channels := ChannelList{testChannel("Y", PixelTypeHalf, 1, 1)}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 0}
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// The data is not valid zip data, so the block can only be decoded if it
+	// is recognized as being stored as is.
+	buffer, err := DecompressBlock(data, block, channels, NewZipDecompressor())
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), data) {
+		t.Fatalf("got %v, want %v", buffer.Bytes(), data)
+	}
+}
+
+func TestCompressBlock(t *testing.T) {
+	channels := ChannelList{testChannel("Y", PixelTypeHalf, 1, 1)}
+	testCases := []struct {
+		name  string
+		block Box2i
+		value func(channel int, x, y int32) float32
+		raw   bool
+	}{
+		{
+			name:  "compressible",
+			block: Box2i{XMin: 0, YMin: 0, XMax: 63, YMax: 3},
+			value: func(channel int, x, y int32) float32 { return 1 },
+		},
+		{
+			// A single pixel does not get smaller when it is compressed, so
+			// it is stored as is.
+			name:  "incompressible",
+			block: Box2i{XMin: 0, YMin: 0, XMax: 0, YMax: 0},
+			value: func(channel int, x, y int32) float32 { return 1 },
+			raw:   true,
+		},
+	}
+	for _, tc := range testCases {
+		data := testBlockData(channels, tc.block, tc.value)
+		compressed, err := CompressBlock(data, tc.block, NewZipCompressor(6))
+		if err != nil {
+			t.Fatalf("%s: error compressing block: %v", tc.name, err)
+		}
+		if raw := bytes.Equal(compressed, data); raw != tc.raw {
+			t.Fatalf("%s: got block stored as is: %t, want %t", tc.name, raw, tc.raw)
+		}
+		if !tc.raw && len(compressed) >= len(data) {
+			t.Fatalf("%s: compressed block is not smaller (%d >= %d)", tc.name, len(compressed), len(data))
+		}
+
+		buffer, err := DecompressBlock(compressed, tc.block, channels, NewZipDecompressor())
+		if err != nil {
+			t.Fatalf("%s: error decompressing block: %v", tc.name, err)
+		}
+		if !bytes.Equal(buffer.Bytes(), data) {
+			t.Fatalf("%s: got % x, want % x", tc.name, buffer.Bytes(), data)
+		}
+	}
+}
@@ -22,6 +22,10 @@ func ReadBox2i(in io.Reader, target *Box2i) error {
 	return nil
 }
 
+func WriteBox2i(out io.Writer, box Box2i) error {
+	return Write(out, box)
+}
+
 type Box2i struct {
 	XMin int32
 	YMin int32
@@ -43,3 +47,26 @@ func (b Box2i) Contains(other Box2i) bool {
 		other.YMin >= b.YMin &&
 		other.YMax <= b.YMax
 }
+
+// Intersect returns the largest box that is contained by both b and other.
+// The result is empty if the two boxes do not overlap.
+func (b Box2i) Intersect(other Box2i) Box2i {
+	if other.XMin > b.XMin {
+		b.XMin = other.XMin
+	}
+	if other.YMin > b.YMin {
+		b.YMin = other.YMin
+	}
+	if other.XMax < b.XMax {
+		b.XMax = other.XMax
+	}
+	if other.YMax < b.YMax {
+		b.YMax = other.YMax
+	}
+	return b
+}
+
+// IsEmpty returns whether the box contains no pixels.
+func (b Box2i) IsEmpty() bool {
+	return b.XMin > b.XMax || b.YMin > b.YMax
+}
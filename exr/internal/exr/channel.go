@@ -37,8 +37,45 @@ func ReadChannelList(in io.Reader, target *ChannelList) error {
 	return nil
 }
 
+func WriteChannelList(out io.Writer, channels ChannelList) error {
+	for _, channel := range channels {
+		if err := WriteNullTerminatedString(out, channel.Name); err != nil {
+			return fmt.Errorf("error writing channel name: %w", err)
+		}
+		if err := Write(out, channel.PixelType); err != nil {
+			return fmt.Errorf("error writing channel pixel type: %w", err)
+		}
+		if err := Write(out, channel.Linear); err != nil {
+			return fmt.Errorf("error writing channel linearity: %w", err)
+		}
+		var reserved [3]int8
+		if err := Write(out, reserved); err != nil {
+			return fmt.Errorf("error writing channel reserved data: %w", err)
+		}
+		if err := Write(out, channel.XSampling); err != nil {
+			return fmt.Errorf("error writing channel x sampling: %w", err)
+		}
+		if err := Write(out, channel.YSampling); err != nil {
+			return fmt.Errorf("error writing channel y sampling: %w", err)
+		}
+	}
+	return WriteNullTerminatedString(out, "")
+}
+
 type ChannelList []Channel
 
+// BlockSize returns the number of bytes that the uncompressed pixel data of
+// the channels occupies within the specified block.
+func (l ChannelList) BlockSize(block Box2i) int {
+	size := 0
+	for _, channel := range l {
+		xCount := int(NumSamples(channel.XSampling, block.XMin, block.XMax))
+		yCount := int(NumSamples(channel.YSampling, block.YMin, block.YMax))
+		size += xCount * yCount * channel.PixelType.ByteSize()
+	}
+	return size
+}
+
 type Channel struct {
 	Name      string
 	PixelType PixelType
@@ -67,3 +104,57 @@ func (t PixelType) String() string {
 		return fmt.Sprintf("UNKNOWN(%d)", t)
 	}
 }
+
+// ByteSize returns the number of bytes that a single value of this pixel
+// type occupies.
+func (t PixelType) ByteSize() int {
+	switch t {
+	case PixelTypeHalf:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// NumSamples returns the number of samples that a channel with the specified
+// sampling has in the inclusive range [min, max].
+func NumSamples(sampling, min, max int32) int32 {
+	a := Div(min, sampling)
+	b := Div(max, sampling)
+	if a*sampling < min {
+		return b - a
+	}
+	return b - a + 1
+}
+
+// SamplingWindow returns the smallest window that contains window and
+// whose edges are aligned to the specified sampling.
+func SamplingWindow(window Box2i, xSampling, ySampling int32) Box2i {
+	return Box2i{
+		XMin: Div(window.XMin, xSampling) * xSampling,
+		YMin: Div(window.YMin, ySampling) * ySampling,
+		XMax: Div(window.XMax, xSampling)*xSampling + xSampling - 1,
+		YMax: Div(window.YMax, ySampling)*ySampling + ySampling - 1,
+	}
+}
+
+// Div returns the integer division of x by y, rounded towards negative
+// infinity.
+func Div(x, y int32) int32 {
+	if x >= 0 {
+		if y >= 0 {
+			return x / y
+		}
+		return -(x / -y)
+	}
+	if y >= 0 {
+		return -((y - 1 - x) / y)
+	}
+	return (-y - 1 - x) / -y
+}
+
+// Mod returns the remainder of the integer division of x by y, such that
+// the result is never negative for positive y.
+func Mod(x, y int32) int32 {
+	return x - y*Div(x, y)
+}
@@ -1,26 +1,110 @@
 package exr
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 )
 
-func ChunkCount(dataWindow Box2i, compression Compression) int {
-	lineCount := compression.LineCount()
-	return (int(dataWindow.YMax-dataWindow.YMin) + lineCount) / lineCount
+func ChunkCount(dataWindow Box2i, compression Compression) (int, error) {
+	lineCount, err := compression.LineCount()
+	if err != nil {
+		return 0, err
+	}
+	return (int(dataWindow.YMax) - int(dataWindow.YMin) + lineCount) / lineCount, nil
 }
 
-func ReadOffsets(in io.Reader, chunkCount int) error {
-	var lastOffset uint64
+// ReadOffsets reads the chunk offset table. The offsets need not be
+// increasing, since chunks can be stored in any order (e.g. when the
+// DECREASING_Y or RANDOM_Y line order is used).
+func ReadOffsets(in io.Reader, chunkCount int, target *[]uint64) error {
+	// The offsets are appended instead of read into a preallocated slice,
+	// so that a corrupt chunk count cannot cause a huge allocation.
+	offsets := make([]uint64, 0, minInt(chunkCount, 1024))
 	for i := 0; i < chunkCount; i++ {
 		var offset uint64
 		if err := Read(in, &offset); err != nil {
 			return fmt.Errorf("error reading offset: %w", err)
 		}
-		if offset < lastOffset {
-			return fmt.Errorf("non-incrementing chunk offsets")
+		offsets = append(offsets, offset)
+	}
+	*target = offsets
+	return nil
+}
+
+// WriteOffsets writes the chunk offset table.
+func WriteOffsets(out io.Writer, offsets []uint64) error {
+	return Write(out, offsets)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ReadChunkData reads the size prefixed data of a chunk.
+func ReadChunkData(in io.Reader, target *[]byte) error {
+	var dataSize int32
+	if err := Read(in, &dataSize); err != nil {
+		return fmt.Errorf("error reading block data size: %w", err)
+	}
+	if dataSize < 0 {
+		return fmt.Errorf("invalid block data size %d", dataSize)
+	}
+	buffer := &bytes.Buffer{}
+	if _, err := io.CopyN(buffer, in, int64(dataSize)); err != nil {
+		return fmt.Errorf("error reading block data: %w", err)
+	}
+	*target = buffer.Bytes()
+	return nil
+}
+
+// WriteChunkData writes the data of a chunk, prefixed by its size.
+func WriteChunkData(out io.Writer, data []byte) error {
+	if err := Write(out, int32(len(data))); err != nil {
+		return fmt.Errorf("error writing block data size: %w", err)
+	}
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("error writing block data: %w", err)
+	}
+	return nil
+}
+
+// SkipChunk skips a chunk that belongs to a part of the specified type.
+func SkipChunk(in io.Reader, partType PartType) error {
+	coordinatesSize := int64(4)
+	if partType.IsTiled() {
+		coordinatesSize = 4 * 4
+	}
+	if _, err := io.CopyN(io.Discard, in, coordinatesSize); err != nil {
+		return fmt.Errorf("error reading chunk coordinates: %w", err)
+	}
+
+	var dataSize int64
+	if partType.IsDeep() {
+		var sizes [3]uint64 // packed table, packed data, unpacked data
+		if err := Read(in, &sizes); err != nil {
+			return fmt.Errorf("error reading deep chunk sizes: %w", err)
+		}
+		if sizes[0] > math.MaxInt32 || sizes[1] > math.MaxInt32 {
+			return fmt.Errorf("invalid deep chunk sizes %d and %d", sizes[0], sizes[1])
 		}
-		lastOffset = offset
+		dataSize = int64(sizes[0] + sizes[1])
+	} else {
+		var size int32
+		if err := Read(in, &size); err != nil {
+			return fmt.Errorf("error reading block data size: %w", err)
+		}
+		if size < 0 {
+			return fmt.Errorf("invalid block data size %d", size)
+		}
+		dataSize = int64(size)
+	}
+	if _, err := io.CopyN(io.Discard, in, dataSize); err != nil {
+		return fmt.Errorf("error reading block data: %w", err)
 	}
 	return nil
 }
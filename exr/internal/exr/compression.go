@@ -9,6 +9,10 @@ func ReadCompression(in io.Reader, target *Compression) error {
 	return Read(in, target)
 }
 
+func WriteCompression(out io.Writer, compression Compression) error {
+	return Write(out, compression)
+}
+
 const (
 	CompressionNone  Compression = 0
 	CompressionRLE   Compression = 1
@@ -18,30 +22,45 @@ const (
 	CompressionPXR24 Compression = 5
 	CompressionB44   Compression = 6
 	CompressionB44A  Compression = 7
+	CompressionDWAA  Compression = 8
+	CompressionDWAB  Compression = 9
 )
 
 type Compression uint8
 
-func (c Compression) LineCount() int {
+// IsKnown returns whether the compression is one of the compression types
+// that are defined by the OpenEXR specification.
+func (c Compression) IsKnown() bool {
+	_, err := c.LineCount()
+	return err == nil
+}
+
+// LineCount returns the number of scan lines that are compressed together
+// into a single block.
+func (c Compression) LineCount() (int, error) {
 	switch c {
 	case CompressionNone:
-		return 1
+		return 1, nil
 	case CompressionRLE:
-		return 1
+		return 1, nil
 	case CompressionZIPS:
-		return 1
+		return 1, nil
 	case CompressionZIP:
-		return 16
+		return 16, nil
 	case CompressionPIZ:
-		return 32
+		return 32, nil
 	case CompressionPXR24:
-		return 16
+		return 16, nil
 	case CompressionB44:
-		return 32
+		return 32, nil
 	case CompressionB44A:
-		return 32
+		return 32, nil
+	case CompressionDWAA:
+		return 32, nil
+	case CompressionDWAB:
+		return 256, nil
 	default:
-		panic(fmt.Errorf("unknown compression type %d", c))
+		return 0, fmt.Errorf("unknown compression type %d", c)
 	}
 }
 
@@ -63,6 +82,10 @@ func (c Compression) String() string {
 		return "B44"
 	case CompressionB44A:
 		return "B44A"
+	case CompressionDWAA:
+		return "DWAA"
+	case CompressionDWAB:
+		return "DWAB"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", c)
 	}
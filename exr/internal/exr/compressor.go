@@ -0,0 +1,96 @@
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+)
+
+type Compressor interface {
+	Compress(src []byte, block Box2i) ([]byte, error)
+}
+
+// CompressBlock returns the pixel data of the specified block in the form
+// in which it is stored in a chunk. The data is stored as is, if compressing
+// it does not make it smaller, since that is how DecompressBlock tells the
+// two apart.
+func CompressBlock(data []byte, block Box2i, compressor Compressor) ([]byte, error) {
+	compressed, err := compressor.Compress(data, block)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) >= len(data) {
+		return data, nil
+	}
+	return compressed, nil
+}
+
+func NewNopCompressor() Compressor {
+	return &nopCompressor{}
+}
+
+type nopCompressor struct{}
+
+func (c *nopCompressor) Compress(src []byte, block Box2i) ([]byte, error) {
+	return src, nil
+}
+
+// NewZipCompressor returns a compressor for the ZIPS and ZIP compressions
+// that uses the specified zlib compression level.
+func NewZipCompressor(level int) Compressor {
+	return &zipCompressor{
+		level: level,
+	}
+}
+
+type zipCompressor struct {
+	level int
+}
+
+func (c *zipCompressor) Compress(src []byte, block Box2i) ([]byte, error) {
+	data := separateScalar(src)
+	predictScalar(data)
+	return deflate(data, c.level)
+}
+
+// deflate returns the zlib compressed contents of data.
+func deflate(data []byte, level int) ([]byte, error) {
+	out := &bytes.Buffer{}
+	zlibOut, err := zlib.NewWriterLevel(out, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zlibOut.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zlibOut.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// predictScalar applies the delta predictor that is used by the RLE and
+// ZIP compressions. It is the inverse of reconstructScalar.
+func predictScalar(data []byte) {
+	for i := len(data) - 1; i > 0; i-- {
+		data[i] = data[i] - data[i-1] + 128
+	}
+}
+
+// separateScalar splits the data into two halves, one with the bytes at
+// even positions and one with the bytes at odd positions. It is the inverse
+// of interleaveScalar.
+func separateScalar(data []byte) []byte {
+	result := make([]byte, len(data))
+	i1 := 0
+	i2 := (len(data) + 1) / 2
+	for j, value := range data {
+		if j%2 == 0 {
+			result[i1] = value
+			i1++
+		} else {
+			result[i2] = value
+			i2++
+		}
+	}
+	return result
+}
@@ -3,11 +3,12 @@ package exr
 import (
 	"bytes"
 	"compress/zlib"
+	"fmt"
 	"io"
 )
 
 type Decompressor interface {
-	Decompress(src *bytes.Buffer) (*bytes.Buffer, error)
+	Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error)
 }
 
 func NewNopDecompressor() Decompressor {
@@ -16,17 +17,70 @@ func NewNopDecompressor() Decompressor {
 
 type nopDecompressor struct{}
 
-func (d *nopDecompressor) Decompress(src *bytes.Buffer) (*bytes.Buffer, error) {
+func (d *nopDecompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
 	return src, nil
 }
 
+func NewRLEDecompressor() Decompressor {
+	return &rleDecompressor{}
+}
+
+type rleDecompressor struct{}
+
+func (d *rleDecompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
+	data, err := rleUncompress(src.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	reconstructScalar(data)
+	return bytes.NewBuffer(interleaveScalar(data)), nil
+}
+
+// rleUncompress expands the run-length encoded data in.
+func rleUncompress(in []byte) ([]byte, error) {
+	var data []byte
+	for len(in) > 0 {
+		count := int(int8(in[0]))
+		in = in[1:]
+		if count < 0 {
+			// literal run of -count bytes
+			count = -count
+			if len(in) < count {
+				return nil, fmt.Errorf("truncated literal run")
+			}
+			data = append(data, in[:count]...)
+			in = in[count:]
+		} else {
+			// repeated run of count+1 bytes
+			if len(in) < 1 {
+				return nil, fmt.Errorf("truncated repeated run")
+			}
+			for i := 0; i <= count; i++ {
+				data = append(data, in[0])
+			}
+			in = in[1:]
+		}
+	}
+	return data, nil
+}
+
 func NewZipDecompressor() Decompressor {
 	return &zipDecompressor{}
 }
 
 type zipDecompressor struct{}
 
-func (d *zipDecompressor) Decompress(src *bytes.Buffer) (*bytes.Buffer, error) {
+func (d *zipDecompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
+	data, err := inflate(src)
+	if err != nil {
+		return nil, err
+	}
+	reconstructScalar(data)
+	return bytes.NewBuffer(interleaveScalar(data)), nil
+}
+
+// inflate returns the zlib decompressed contents of src.
+func inflate(src io.Reader) ([]byte, error) {
 	zlibIn, err := zlib.NewReader(src)
 	if err != nil {
 		return nil, err
@@ -38,16 +92,21 @@ func (d *zipDecompressor) Decompress(src *bytes.Buffer) (*bytes.Buffer, error) {
 	if err := zlibIn.Close(); err != nil {
 		return nil, err
 	}
+	return out.Bytes(), nil
+}
 
-	data := out.Bytes()
-
-	// reconstruct scalar
+// reconstructScalar undoes the delta predictor that is applied by the
+// RLE and ZIP compressions.
+func reconstructScalar(data []byte) {
 	for i := 1; i < len(data); i++ {
 		v := int(data[i-1]) + int(data[i]) - 128
 		data[i] = byte(v)
 	}
+}
 
-	// interleave scalar
+// interleaveScalar combines the two halves of the data, which the RLE and ZIP
+// compressions keep separate, back into a single byte sequence.
+func interleaveScalar(data []byte) []byte {
 	result := make([]byte, len(data))
 	i1 := 0
 	i2 := (len(data) + 1) / 2
@@ -64,6 +123,5 @@ func (d *zipDecompressor) Decompress(src *bytes.Buffer) (*bytes.Buffer, error) {
 		j++
 		i2++
 	}
-
-	return bytes.NewBuffer(result), nil
+	return result
 }
@@ -0,0 +1,235 @@
+package exr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/x448/float16"
+)
+
+func ReadDeepScanLineChunk(in io.Reader, target *DeepScanLineChunk) error {
+	if err := Read(in, &target.Y); err != nil {
+		return fmt.Errorf("error reading block y coordinate: %w", err)
+	}
+	return ReadDeepChunkData(in, &target.DeepChunkData)
+}
+
+type DeepScanLineChunk struct {
+	Y int32
+	DeepChunkData
+}
+
+func ReadDeepTileChunk(in io.Reader, target *DeepTileChunk) error {
+	if err := ReadTileCoordinates(in, &target.TileCoordinates); err != nil {
+		return err
+	}
+	return ReadDeepChunkData(in, &target.DeepChunkData)
+}
+
+type DeepTileChunk struct {
+	TileCoordinates
+	DeepChunkData
+}
+
+// ReadDeepChunkData reads the sample count table and the sample data of
+// a deep chunk, along with their sizes.
+func ReadDeepChunkData(in io.Reader, target *DeepChunkData) error {
+	var tableSize uint64
+	if err := Read(in, &tableSize); err != nil {
+		return fmt.Errorf("error reading sample count table size: %w", err)
+	}
+	var dataSize uint64
+	if err := Read(in, &dataSize); err != nil {
+		return fmt.Errorf("error reading sample data size: %w", err)
+	}
+	if err := Read(in, &target.UnpackedDataSize); err != nil {
+		return fmt.Errorf("error reading unpacked sample data size: %w", err)
+	}
+	if tableSize > math.MaxInt32 || dataSize > math.MaxInt32 {
+		return fmt.Errorf("invalid deep chunk sizes %d and %d", tableSize, dataSize)
+	}
+
+	// The data is copied instead of read into a preallocated slice,
+	// so that a corrupt size cannot cause a huge allocation.
+	tableBuffer := &bytes.Buffer{}
+	if _, err := io.CopyN(tableBuffer, in, int64(tableSize)); err != nil {
+		return fmt.Errorf("error reading sample count table: %w", err)
+	}
+	target.SampleCountTable = tableBuffer.Bytes()
+
+	dataBuffer := &bytes.Buffer{}
+	if _, err := io.CopyN(dataBuffer, in, int64(dataSize)); err != nil {
+		return fmt.Errorf("error reading sample data: %w", err)
+	}
+	target.SampleData = dataBuffer.Bytes()
+	return nil
+}
+
+type DeepChunkData struct {
+	SampleCountTable []byte
+	SampleData       []byte
+	UnpackedDataSize uint64
+}
+
+// DecompressDeepBlock returns the uncompressed sample count table and
+// sample data of the specified block. Each of them is only decompressed if
+// it is smaller than its uncompressed size.
+func DecompressDeepBlock(data DeepChunkData, block Box2i, decompressor Decompressor) ([]byte, []byte, error) {
+	table := data.SampleCountTable
+	if tableSize := int(block.Width()) * int(block.Height()) * 4; len(table) < tableSize {
+		buffer, err := decompressor.Decompress(bytes.NewBuffer(table), block)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decompressing sample count table: %w", err)
+		}
+		table = buffer.Bytes()
+	}
+	if len(table) != int(block.Width())*int(block.Height())*4 {
+		return nil, nil, fmt.Errorf("invalid sample count table size %d", len(table))
+	}
+
+	samples := data.SampleData
+	if uint64(len(samples)) < data.UnpackedDataSize {
+		buffer, err := decompressor.Decompress(bytes.NewBuffer(samples), block)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decompressing sample data: %w", err)
+		}
+		samples = buffer.Bytes()
+	}
+	if uint64(len(samples)) != data.UnpackedDataSize {
+		return nil, nil, fmt.Errorf("invalid sample data size %d", len(samples))
+	}
+	return table, samples, nil
+}
+
+// NewDeepData creates a new DeepData that can hold the samples of the
+// specified channels within the specified window.
+func NewDeepData(window Box2i, channels ChannelList) *DeepData {
+	pixelCount := int(window.Width()) * int(window.Height())
+	return &DeepData{
+		window:        window,
+		channels:      channels,
+		sampleOffsets: make([]int, pixelCount),
+		sampleCounts:  make([]uint32, pixelCount),
+		samples:       make([][]float32, len(channels)),
+	}
+}
+
+// DeepData holds the samples of all channels of a deep image.
+//
+// The samples of each channel are kept in a single slice, where the
+// samples of a pixel are stored next to each other.
+type DeepData struct {
+	mu            sync.Mutex
+	window        Box2i
+	channels      ChannelList
+	sampleOffsets []int
+	sampleCounts  []uint32
+	samples       [][]float32
+}
+
+// ReadBlock reads the uncompressed sample count table and sample data of
+// the specified block. It is safe to call ReadBlock concurrently.
+func (d *DeepData) ReadBlock(table, data []byte, block Box2i) error {
+	width := int(block.Width())
+	height := int(block.Height())
+
+	// The table holds the cumulative sample count of each pixel, which
+	// starts over on every scan line.
+	counts := make([]uint32, width*height)
+	rowOffsets := make([]int, height)
+	total := 0
+	for row := 0; row < height; row++ {
+		rowOffsets[row] = total
+		var last uint32
+		for col := 0; col < width; col++ {
+			index := row*width + col
+			value := order.Uint32(table[index*4:])
+			if value < last || value > math.MaxInt32 {
+				return fmt.Errorf("invalid cumulative sample count %d", value)
+			}
+			counts[index] = value - last
+			last = value
+		}
+		total += int(last)
+	}
+
+	pixelSize := 0
+	for _, channel := range d.channels {
+		pixelSize += channel.PixelType.ByteSize()
+	}
+	if pixelSize == 0 && len(data) != 0 || pixelSize > 0 && (len(data)%pixelSize != 0 || len(data)/pixelSize != total) {
+		return fmt.Errorf("sample data size %d does not match sample count %d", len(data), total)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	base := 0
+	if len(d.samples) > 0 {
+		base = len(d.samples[0])
+	}
+	offset := base
+	for row := 0; row < height; row++ {
+		y := block.YMin + int32(row) - d.window.YMin
+		for col := 0; col < width; col++ {
+			x := block.XMin + int32(col) - d.window.XMin
+			pixel := int(y)*int(d.window.Width()) + int(x)
+			d.sampleOffsets[pixel] = offset
+			d.sampleCounts[pixel] = counts[row*width+col]
+			offset += int(counts[row*width+col])
+		}
+	}
+	for i := range d.samples {
+		d.samples[i] = append(d.samples[i], make([]float32, total)...)
+	}
+
+	// The sample data is stored line by line, with the samples of each
+	// channel following those of the previous channel.
+	position := 0
+	for row := 0; row < height; row++ {
+		rowStart, rowEnd := row*width, (row+1)*width
+		for i, channel := range d.channels {
+			target := d.samples[i]
+			offset := base + rowOffsets[row]
+			for _, count := range counts[rowStart:rowEnd] {
+				for s := 0; s < int(count); s++ {
+					target[offset] = readSample(data[position:], channel.PixelType)
+					position += channel.PixelType.ByteSize()
+					offset++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SampleCount returns the number of samples of the pixel at (x, y).
+func (d *DeepData) SampleCount(x, y int) int {
+	return int(d.sampleCounts[d.pixelIndex(x, y)])
+}
+
+// Float32 returns the specified sample of the pixel at (x, y) of the
+// channel with the specified index.
+func (d *DeepData) Float32(channel, x, y, sample int) float32 {
+	return d.samples[channel][d.sampleOffsets[d.pixelIndex(x, y)]+sample]
+}
+
+func (d *DeepData) pixelIndex(x, y int) int {
+	offX := x - int(d.window.XMin)
+	offY := y - int(d.window.YMin)
+	return offX + int(d.window.Width())*offY
+}
+
+func readSample(data []byte, pixelType PixelType) float32 {
+	switch pixelType {
+	case PixelTypeUint:
+		return float32(order.Uint32(data))
+	case PixelTypeHalf:
+		return float16.Frombits(order.Uint16(data)).Float32()
+	default:
+		return math.Float32frombits(order.Uint32(data))
+	}
+}
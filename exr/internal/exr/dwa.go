@@ -0,0 +1,613 @@
+package exr
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/x448/float16"
+)
+
+// The DWA compression implemented here follows the one used by the DWAA and
+// DWAB compressions in the OpenEXR reference implementation
+// (ImfDwaCompressor.cpp).
+
+const (
+	dwaVersion                 = 0
+	dwaUnknownUncompressedSize = 1
+	dwaUnknownCompressedSize   = 2
+	dwaACCompressedSize        = 3
+	dwaDCCompressedSize        = 4
+	dwaRLECompressedSize       = 5
+	dwaRLEUncompressedSize     = 6
+	dwaRLERawSize              = 7
+	dwaACUncompressedCount     = 8
+	dwaDCUncompressedCount     = 9
+	dwaACCompression           = 10
+	dwaSizeCount               = 11
+)
+
+const (
+	dwaSchemeUnknown  dwaScheme = 0
+	dwaSchemeLossyDCT dwaScheme = 1
+	dwaSchemeRLE      dwaScheme = 2
+)
+
+type dwaScheme int
+
+const (
+	dwaACCompressionStaticHuffman = 0
+	dwaACCompressionDeflate       = 1
+)
+
+// dwaRule determines the scheme with which a channel is compressed, based
+// on the suffix of its name (the part after the last dot) and its type.
+type dwaRule struct {
+	suffix          string
+	scheme          dwaScheme
+	pixelType       PixelType
+	cscIndex        int
+	caseInsensitive bool
+}
+
+func (r dwaRule) Matches(suffix string, pixelType PixelType) bool {
+	if r.pixelType != pixelType {
+		return false
+	}
+	if r.caseInsensitive {
+		return strings.EqualFold(r.suffix, suffix)
+	}
+	return r.suffix == suffix
+}
+
+// dwaLegacyRules are the rules that apply to DWA data prior to version 2,
+// which does not store its rules in the compressed data.
+var dwaLegacyRules = []dwaRule{
+	{suffix: "r", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 0, caseInsensitive: true},
+	{suffix: "r", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 0, caseInsensitive: true},
+	{suffix: "red", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 0, caseInsensitive: true},
+	{suffix: "red", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 0, caseInsensitive: true},
+	{suffix: "g", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 1, caseInsensitive: true},
+	{suffix: "g", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 1, caseInsensitive: true},
+	{suffix: "grn", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 1, caseInsensitive: true},
+	{suffix: "grn", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 1, caseInsensitive: true},
+	{suffix: "green", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 1, caseInsensitive: true},
+	{suffix: "green", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 1, caseInsensitive: true},
+	{suffix: "b", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 2, caseInsensitive: true},
+	{suffix: "b", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 2, caseInsensitive: true},
+	{suffix: "blu", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 2, caseInsensitive: true},
+	{suffix: "blu", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 2, caseInsensitive: true},
+	{suffix: "blue", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: 2, caseInsensitive: true},
+	{suffix: "blue", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 2, caseInsensitive: true},
+	{suffix: "y", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: -1, caseInsensitive: true},
+	{suffix: "y", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: -1, caseInsensitive: true},
+	{suffix: "by", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: -1, caseInsensitive: true},
+	{suffix: "by", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: -1, caseInsensitive: true},
+	{suffix: "ry", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeHalf, cscIndex: -1, caseInsensitive: true},
+	{suffix: "ry", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: -1, caseInsensitive: true},
+	{suffix: "a", scheme: dwaSchemeRLE, pixelType: PixelTypeUint, cscIndex: -1, caseInsensitive: true},
+	{suffix: "a", scheme: dwaSchemeRLE, pixelType: PixelTypeHalf, cscIndex: -1, caseInsensitive: true},
+	{suffix: "a", scheme: dwaSchemeRLE, pixelType: PixelTypeFloat, cscIndex: -1, caseInsensitive: true},
+}
+
+// readDwaRules parses the rules that are stored at the beginning of
+// version 2 DWA data and returns them along with the remaining data.
+func readDwaRules(in []byte) ([]dwaRule, []byte, error) {
+	if len(in) < 2 {
+		return nil, nil, fmt.Errorf("dwa rules too short")
+	}
+	size := int(order.Uint16(in))
+	if size < 2 || size > len(in) {
+		return nil, nil, fmt.Errorf("invalid dwa rules size %d", size)
+	}
+	data := in[2:size]
+
+	var rules []dwaRule
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 || len(data) < end+3 {
+			return nil, nil, fmt.Errorf("truncated dwa rule")
+		}
+		value := data[end+1]
+		rule := dwaRule{
+			suffix:          string(data[:end]),
+			cscIndex:        int(value>>4) - 1,
+			scheme:          dwaScheme((value >> 2) & 3),
+			caseInsensitive: value&1 != 0,
+			pixelType:       PixelType(data[end+2]),
+		}
+		if rule.cscIndex < -1 || rule.cscIndex >= 3 {
+			return nil, nil, fmt.Errorf("invalid dwa rule color index %d", rule.cscIndex)
+		}
+		if rule.scheme > dwaSchemeRLE {
+			return nil, nil, fmt.Errorf("invalid dwa rule scheme %d", rule.scheme)
+		}
+		if rule.pixelType > PixelTypeFloat {
+			return nil, nil, fmt.Errorf("invalid dwa rule pixel type %q", rule.pixelType)
+		}
+		rules = append(rules, rule)
+		data = data[end+3:]
+	}
+	return rules, in[size:], nil
+}
+
+func NewDwaDecompressor(channels ChannelList) Decompressor {
+	return &dwaDecompressor{
+		channels: channels,
+	}
+}
+
+type dwaDecompressor struct {
+	channels ChannelList
+}
+
+type dwaChannelData struct {
+	channel Channel
+	scheme  dwaScheme
+	width   int
+	height  int
+	rows    [][]byte
+	decoded bool
+}
+
+func (d *dwaDecompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
+	in := src.Bytes()
+	if len(in) < dwaSizeCount*8 {
+		return nil, fmt.Errorf("dwa header too short")
+	}
+	var sizes [dwaSizeCount]uint64
+	for i := range sizes {
+		sizes[i] = order.Uint64(in[i*8:])
+	}
+	in = in[dwaSizeCount*8:]
+
+	version := sizes[dwaVersion]
+	if version > 2 {
+		return nil, fmt.Errorf("unsupported dwa version %d", version)
+	}
+	rules := dwaLegacyRules
+	if version == 2 {
+		var err error
+		rules, in, err = readDwaRules(in)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dwa rules: %w", err)
+		}
+	}
+
+	var (
+		unknownCompressedSize = sizes[dwaUnknownCompressedSize]
+		acCompressedSize      = sizes[dwaACCompressedSize]
+		dcCompressedSize      = sizes[dwaDCCompressedSize]
+		rleCompressedSize     = sizes[dwaRLECompressedSize]
+		dataSize              = uint64(len(in))
+	)
+	if unknownCompressedSize > dataSize || acCompressedSize > dataSize ||
+		dcCompressedSize > dataSize || rleCompressedSize > dataSize ||
+		unknownCompressedSize+acCompressedSize+dcCompressedSize+rleCompressedSize > dataSize {
+		return nil, fmt.Errorf("invalid dwa data sizes")
+	}
+	unknownData := in[:unknownCompressedSize]
+	in = in[unknownCompressedSize:]
+	acData := in[:acCompressedSize]
+	in = in[acCompressedSize:]
+	dcData := in[:dcCompressedSize]
+	in = in[dcCompressedSize:]
+	rleData := in[:rleCompressedSize]
+
+	channelData, cscSets := classifyDwaChannels(d.channels, rules)
+
+	outSize := 0
+	for i := range channelData {
+		cd := &channelData[i]
+		cd.width = int(NumSamples(cd.channel.XSampling, block.XMin, block.XMax))
+		cd.height = int(NumSamples(cd.channel.YSampling, block.YMin, block.YMax))
+		outSize += cd.width * cd.height * cd.channel.PixelType.ByteSize()
+	}
+	out := make([]byte, outSize)
+	offset := 0
+	for y := block.YMin; y <= block.YMax; y++ {
+		for i := range channelData {
+			cd := &channelData[i]
+			if Mod(y, cd.channel.YSampling) != 0 {
+				continue
+			}
+			rowSize := cd.width * cd.channel.PixelType.ByteSize()
+			cd.rows = append(cd.rows, out[offset:offset+rowSize])
+			offset += rowSize
+		}
+	}
+
+	var unknown []byte
+	if unknownCompressedSize > 0 {
+		var err error
+		unknown, err = inflate(bytes.NewReader(unknownData))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing dwa unknown data: %w", err)
+		}
+	}
+
+	var ac []uint16
+	if acCompressedSize > 0 {
+		acCount := sizes[dwaACUncompressedCount]
+		if acCount > uint64(outSize) {
+			return nil, fmt.Errorf("invalid dwa ac count %d", acCount)
+		}
+		ac = make([]uint16, acCount)
+		switch sizes[dwaACCompression] {
+		case dwaACCompressionStaticHuffman:
+			if err := hufUncompress(acData, ac); err != nil {
+				return nil, fmt.Errorf("error decompressing dwa ac data: %w", err)
+			}
+		case dwaACCompressionDeflate:
+			data, err := inflate(bytes.NewReader(acData))
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing dwa ac data: %w", err)
+			}
+			if len(data) != len(ac)*2 {
+				return nil, fmt.Errorf("invalid dwa ac data size")
+			}
+			for i := range ac {
+				ac[i] = order.Uint16(data[i*2:])
+			}
+		default:
+			return nil, fmt.Errorf("unsupported dwa ac compression %d", sizes[dwaACCompression])
+		}
+	}
+
+	var dc []uint16
+	if dcCompressedSize > 0 {
+		data, err := inflate(bytes.NewReader(dcData))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing dwa dc data: %w", err)
+		}
+		if uint64(len(data)) != sizes[dwaDCUncompressedCount]*2 {
+			return nil, fmt.Errorf("invalid dwa dc data size")
+		}
+		reconstructScalar(data)
+		data = interleaveScalar(data)
+		dc = make([]uint16, len(data)/2)
+		for i := range dc {
+			dc[i] = order.Uint16(data[i*2:])
+		}
+	}
+
+	var rle []byte
+	if sizes[dwaRLERawSize] > 0 {
+		data, err := inflate(bytes.NewReader(rleData))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing dwa rle data: %w", err)
+		}
+		if uint64(len(data)) != sizes[dwaRLEUncompressedSize] {
+			return nil, fmt.Errorf("invalid dwa rle data size")
+		}
+		rle, err = rleUncompress(data)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing dwa rle data: %w", err)
+		}
+		if uint64(len(rle)) != sizes[dwaRLERawSize] {
+			return nil, fmt.Errorf("invalid dwa rle raw size")
+		}
+	}
+
+	decoder := &dwaDctDecoder{
+		ac: ac,
+		dc: dc,
+	}
+	for _, set := range cscSets {
+		components := []*dwaChannelData{
+			&channelData[set[0]],
+			&channelData[set[1]],
+			&channelData[set[2]],
+		}
+		if err := decoder.Decode(components, true); err != nil {
+			return nil, fmt.Errorf("error decoding dwa color channels: %w", err)
+		}
+	}
+
+	for i := range channelData {
+		cd := &channelData[i]
+		if cd.decoded {
+			continue
+		}
+		pixelSize := cd.channel.PixelType.ByteSize()
+		switch cd.scheme {
+		case dwaSchemeLossyDCT:
+			if err := decoder.Decode([]*dwaChannelData{cd}, !cd.channel.Linear); err != nil {
+				return nil, fmt.Errorf("error decoding dwa channel %q: %w", cd.channel.Name, err)
+			}
+
+		case dwaSchemeRLE:
+			// The bytes of the values are stored in separate planes.
+			planeSize := cd.width * cd.height
+			if len(rle) < planeSize*pixelSize {
+				return nil, fmt.Errorf("dwa rle data too short")
+			}
+			for row, dst := range cd.rows {
+				for x := 0; x < cd.width; x++ {
+					for b := 0; b < pixelSize; b++ {
+						dst[x*pixelSize+b] = rle[b*planeSize+row*cd.width+x]
+					}
+				}
+			}
+			rle = rle[planeSize*pixelSize:]
+
+		case dwaSchemeUnknown:
+			for _, dst := range cd.rows {
+				if len(unknown) < len(dst) {
+					return nil, fmt.Errorf("dwa unknown data too short")
+				}
+				copy(dst, unknown)
+				unknown = unknown[len(dst):]
+			}
+		}
+	}
+	return bytes.NewBuffer(out), nil
+}
+
+// classifyDwaChannels determines the compression scheme of each channel and
+// groups the R, G, and B channels that share a name prefix and a sampling
+// into sets that are color converted together.
+func classifyDwaChannels(channels ChannelList, rules []dwaRule) ([]dwaChannelData, [][3]int) {
+	channelData := make([]dwaChannelData, len(channels))
+	prefixSets := make(map[string]*[3]int)
+	for i, channel := range channels {
+		channelData[i].channel = channel
+
+		prefix, suffix := "", channel.Name
+		if dot := strings.LastIndexByte(channel.Name, '.'); dot >= 0 {
+			prefix, suffix = channel.Name[:dot], channel.Name[dot+1:]
+		}
+		set, ok := prefixSets[prefix]
+		if !ok {
+			set = &[3]int{-1, -1, -1}
+			prefixSets[prefix] = set
+		}
+		for _, rule := range rules {
+			if rule.Matches(suffix, channel.PixelType) {
+				channelData[i].scheme = rule.scheme
+				if rule.cscIndex >= 0 {
+					set[rule.cscIndex] = i
+				}
+			}
+		}
+	}
+
+	prefixes := make([]string, 0, len(prefixSets))
+	for prefix := range prefixSets {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var cscSets [][3]int
+	for _, prefix := range prefixes {
+		set := *prefixSets[prefix]
+		if set[0] < 0 || set[1] < 0 || set[2] < 0 {
+			continue
+		}
+		r, g, b := channels[set[0]], channels[set[1]], channels[set[2]]
+		if r.XSampling != g.XSampling || r.XSampling != b.XSampling ||
+			r.YSampling != g.YSampling || r.YSampling != b.YSampling {
+			continue
+		}
+		cscSets = append(cscSets, set)
+	}
+	return channelData, cscSets
+}
+
+// dwaDctDecoder decodes lossy DCT compressed channels, consuming the AC and
+// DC coefficients as it goes.
+type dwaDctDecoder struct {
+	ac []uint16
+	dc []uint16
+}
+
+// Decode decodes either a single channel or a set of three color channels
+// that have been converted to Y'CbCr prior to compression. If nonlinear is
+// set, the decoded values are converted back from the nonlinear space that
+// they have been compressed in.
+func (d *dwaDctDecoder) Decode(components []*dwaChannelData, nonlinear bool) error {
+	width, height := components[0].width, components[0].height
+	for _, cd := range components {
+		if cd.scheme != dwaSchemeLossyDCT {
+			return fmt.Errorf("invalid dwa color conversion")
+		}
+		if cd.channel.PixelType != PixelTypeHalf && cd.channel.PixelType != PixelTypeFloat {
+			return fmt.Errorf("unsupported lossy dct pixel type %q", cd.channel.PixelType)
+		}
+		cd.decoded = true
+	}
+
+	blocksX := (width + 7) / 8
+	blocksY := (height + 7) / 8
+	blockCount := blocksX * blocksY
+	if len(d.dc) < blockCount*len(components) {
+		return fmt.Errorf("not enough dc coefficients")
+	}
+	dcPlanes := make([][]uint16, len(components))
+	for c := range components {
+		dcPlanes[c] = d.dc[c*blockCount : (c+1)*blockCount]
+	}
+	d.dc = d.dc[blockCount*len(components):]
+
+	toLinear := dwaToLinear()
+	blocks := make([][64]float32, len(components))
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			for c := range components {
+				var zigzag [64]uint16
+				zigzag[0] = dcPlanes[c][by*blocksX+bx]
+				if err := d.unRleAC(&zigzag); err != nil {
+					return err
+				}
+				for i := range blocks[c] {
+					blocks[c][i] = float16.Frombits(zigzag[dwaZigzag[i]]).Float32()
+				}
+				dctInverse8x8(&blocks[c])
+			}
+			if len(components) == 3 {
+				for i := 0; i < 64; i++ {
+					blocks[0][i], blocks[1][i], blocks[2][i] = csc709Inverse(blocks[0][i], blocks[1][i], blocks[2][i])
+				}
+			}
+
+			for c, cd := range components {
+				for y := 0; y < 8 && by*8+y < height; y++ {
+					row := cd.rows[by*8+y]
+					for x := 0; x < 8 && bx*8+x < width; x++ {
+						value := float16.Fromfloat32(blocks[c][y*8+x]).Bits()
+						if nonlinear {
+							value = toLinear[value]
+						}
+						offset := bx*8 + x
+						switch cd.channel.PixelType {
+						case PixelTypeHalf:
+							order.PutUint16(row[offset*2:], value)
+						case PixelTypeFloat:
+							order.PutUint32(row[offset*4:], math.Float32bits(float16.Frombits(value).Float32()))
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unRleAC reads the AC coefficients of a single block. A value with a high
+// byte of 0xff indicates a run of zeroes with the length of the low byte,
+// except for 0xff00, which marks the end of the block.
+func (d *dwaDctDecoder) unRleAC(zigzag *[64]uint16) error {
+	for i := 1; i < 64; {
+		if len(d.ac) == 0 {
+			return fmt.Errorf("not enough ac coefficients")
+		}
+		value := d.ac[0]
+		d.ac = d.ac[1:]
+		switch {
+		case value == 0xff00:
+			i = 64
+		case value>>8 == 0xff:
+			i += int(value & 0xff)
+		default:
+			zigzag[i] = value
+			i++
+		}
+	}
+	return nil
+}
+
+// dwaZigzag maps the index of a coefficient in an 8x8 block to its index in
+// the zig-zag ordering.
+var dwaZigzag = [64]int{
+	0, 1, 5, 6, 14, 15, 27, 28,
+	2, 4, 7, 13, 16, 26, 29, 42,
+	3, 8, 12, 17, 25, 30, 41, 43,
+	9, 11, 18, 24, 31, 40, 44, 53,
+	10, 19, 23, 32, 39, 45, 52, 54,
+	20, 22, 33, 38, 46, 51, 55, 60,
+	21, 34, 37, 47, 50, 56, 59, 61,
+	35, 36, 48, 49, 57, 58, 62, 63,
+}
+
+var (
+	dctA = float32(0.5 * math.Cos(3.14159/4.0))
+	dctB = float32(0.5 * math.Cos(3.14159/16.0))
+	dctC = float32(0.5 * math.Cos(3.14159/8.0))
+	dctD = float32(0.5 * math.Cos(3.0*3.14159/16.0))
+	dctE = float32(0.5 * math.Cos(5.0*3.14159/16.0))
+	dctF = float32(0.5 * math.Cos(3.0*3.14159/8.0))
+	dctG = float32(0.5 * math.Cos(7.0*3.14159/16.0))
+)
+
+// dctInverse8x8 performs an in-place inverse DCT on an 8x8 block.
+func dctInverse8x8(data *[64]float32) {
+	for row := 0; row < 8; row++ {
+		dctInverse8(data[:], row*8, 1)
+	}
+	for column := 0; column < 8; column++ {
+		dctInverse8(data[:], column, 8)
+	}
+}
+
+// dctInverse8 performs an in-place 1D inverse DCT on the 8 values that
+// start at offset and are stride apart.
+func dctInverse8(data []float32, offset, stride int) {
+	var v [8]float32
+	for i := range v {
+		v[i] = data[offset+i*stride]
+	}
+
+	alpha0 := dctC * v[2]
+	alpha1 := dctF * v[2]
+	alpha2 := dctC * v[6]
+	alpha3 := dctF * v[6]
+
+	beta0 := dctB*v[1] + dctD*v[3] + dctE*v[5] + dctG*v[7]
+	beta1 := dctD*v[1] - dctG*v[3] - dctB*v[5] - dctE*v[7]
+	beta2 := dctE*v[1] - dctB*v[3] + dctG*v[5] + dctD*v[7]
+	beta3 := dctG*v[1] - dctE*v[3] + dctD*v[5] - dctB*v[7]
+
+	theta0 := dctA * (v[0] + v[4])
+	theta3 := dctA * (v[0] - v[4])
+	theta1 := alpha0 + alpha3
+	theta2 := alpha1 - alpha2
+
+	gamma0 := theta0 + theta1
+	gamma1 := theta3 + theta2
+	gamma2 := theta3 - theta2
+	gamma3 := theta0 - theta1
+
+	data[offset+0*stride] = gamma0 + beta0
+	data[offset+1*stride] = gamma1 + beta1
+	data[offset+2*stride] = gamma2 + beta2
+	data[offset+3*stride] = gamma3 + beta3
+	data[offset+4*stride] = gamma3 - beta3
+	data[offset+5*stride] = gamma2 - beta2
+	data[offset+6*stride] = gamma1 - beta1
+	data[offset+7*stride] = gamma0 - beta0
+}
+
+// csc709Inverse converts a Y'CbCr color back to R'G'B', using the Rec. 709
+// primaries.
+func csc709Inverse(y, cb, cr float32) (float32, float32, float32) {
+	r := y + 1.5747*cr
+	g := y - 0.1873*cb - 0.4682*cr
+	b := y + 1.8556*cb
+	return r, g, b
+}
+
+var (
+	dwaToLinearOnce  sync.Once
+	dwaToLinearTable []uint16
+)
+
+// dwaToLinear returns a lookup table that converts half values from the
+// nonlinear space that DWA compresses them in back to linear space.
+func dwaToLinear() []uint16 {
+	dwaToLinearOnce.Do(func() {
+		logBase := math.Pow(2.7182818, 2.2)
+		dwaToLinearTable = make([]uint16, 1<<16)
+		for i := 1; i < len(dwaToLinearTable); i++ {
+			if i&0x7c00 == 0x7c00 {
+				continue // infinity and NaN map to zero
+			}
+			h := float64(float16.Frombits(uint16(i)).Float32())
+			sign := 1.0
+			if h < 0 {
+				sign = -1.0
+				h = -h
+			}
+			var value float64
+			if h <= 1.0 {
+				value = sign * math.Pow(h, 2.2)
+			} else {
+				value = sign * math.Pow(logBase, h-1.0)
+			}
+			dwaToLinearTable[i] = float16.Fromfloat32(float32(value)).Bits()
+		}
+	})
+	return dwaToLinearTable
+}
@@ -0,0 +1,354 @@
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"math"
+	"testing"
+
+	"github.com/x448/float16"
+)
+
+// testDwaBlock describes the parts of a DWA compressed block, which are
+// assembled in the layout of the OpenEXR reference implementation.
+type testDwaBlock struct {
+	version   uint64
+	rules     []byte   // version 2 rules, without their size
+	unknown   []byte   // uncompressed data of the UNKNOWN channels
+	ac        []uint16 // AC coefficients, including the run-length codes
+	acHuffman bool     // whether the AC coefficients are Huffman coded
+	dc        []uint16 // DC coefficients
+	rle       []byte   // byte planes of the RLE channels
+}
+
+func (b testDwaBlock) bytes(t *testing.T) []byte {
+	t.Helper()
+	compress := func(data []byte) []byte {
+		compressed, err := deflate(data, zlib.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compressed
+	}
+	values := func(values []uint16) []byte {
+		out := &bytes.Buffer{}
+		Write(out, values)
+		return out.Bytes()
+	}
+
+	var sizes [dwaSizeCount]uint64
+	sizes[dwaVersion] = b.version
+	var unknownData, acData, dcData, rleData []byte
+	if len(b.unknown) > 0 {
+		unknownData = compress(b.unknown)
+		sizes[dwaUnknownUncompressedSize] = uint64(len(b.unknown))
+		sizes[dwaUnknownCompressedSize] = uint64(len(unknownData))
+	}
+	if len(b.ac) > 0 {
+		if b.acHuffman {
+			acData = hufCompress(b.ac)
+			sizes[dwaACCompression] = dwaACCompressionStaticHuffman
+		} else {
+			acData = compress(values(b.ac))
+			sizes[dwaACCompression] = dwaACCompressionDeflate
+		}
+		sizes[dwaACCompressedSize] = uint64(len(acData))
+		sizes[dwaACUncompressedCount] = uint64(len(b.ac))
+	}
+	if len(b.dc) > 0 {
+		data := separateScalar(values(b.dc))
+		predictScalar(data)
+		dcData = compress(data)
+		sizes[dwaDCCompressedSize] = uint64(len(dcData))
+		sizes[dwaDCUncompressedCount] = uint64(len(b.dc))
+	}
+	if len(b.rle) > 0 {
+		// The planes are stored as literal runs of up to 127 bytes.
+		var encoded []byte
+		for data := b.rle; len(data) > 0; {
+			n := len(data)
+			if n > 127 {
+				n = 127
+			}
+			encoded = append(encoded, byte(-int8(n)))
+			encoded = append(encoded, data[:n]...)
+			data = data[n:]
+		}
+		rleData = compress(encoded)
+		sizes[dwaRLECompressedSize] = uint64(len(rleData))
+		sizes[dwaRLEUncompressedSize] = uint64(len(encoded))
+		sizes[dwaRLERawSize] = uint64(len(b.rle))
+	}
+
+	out := &bytes.Buffer{}
+	Write(out, sizes)
+	if b.version == 2 {
+		Write(out, uint16(len(b.rules)+2))
+		out.Write(b.rules)
+	}
+	out.Write(unknownData)
+	out.Write(acData)
+	out.Write(dcData)
+	out.Write(rleData)
+	return out.Bytes()
+}
+
+// dwaToLinearValue converts a value from the nonlinear space in which DWA
+// compresses it back to linear space.
+func dwaToLinearValue(value float64) float64 {
+	if math.Abs(value) <= 1.0 {
+		return math.Copysign(math.Pow(math.Abs(value), 2.2), value)
+	}
+	return math.Copysign(math.Pow(math.Exp(2.2), math.Abs(value)-1.0), value)
+}
+
+// testPixelValue returns the value at the specified index of the decoded
+// data of a channel with the specified pixel type.
+func testPixelValue(data []byte, pixelType PixelType, index int) float64 {
+	if pixelType == PixelTypeFloat {
+		return float64(math.Float32frombits(order.Uint32(data[index*4:])))
+	}
+	return float64(float16.Frombits(order.Uint16(data[index*2:])).Float32())
+}
+
+func TestDwaDecompressLossyDCT(t *testing.T) {
+	// Blocks that only have a DC coefficient have the same value for all of
+	// their pixels, which is the coefficient divided by 8. The nonlinear
+	// value 1.0 is 1.0 in linear space, whereas 0.5 is 0.5^2.2 (0x32f7).
+	for _, pixelType := range []PixelType{PixelTypeHalf, PixelTypeFloat} {
+		channels := ChannelList{testChannel("diffuse.Y", pixelType, 1, 1)}
+		block := Box2i{XMin: 0, YMin: 0, XMax: 9, YMax: 2}
+		compressed := testDwaBlock{
+			ac: []uint16{0xff00, 0xff00},
+			dc: []uint16{0x4800, 0x4400},
+		}.bytes(t)
+
+		buffer, err := NewDwaDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+		if err != nil {
+			t.Fatalf("%s: error decompressing block: %v", pixelType, err)
+		}
+		want := &bytes.Buffer{}
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 10; x++ {
+				value := uint16(0x3c00)
+				if x >= 8 {
+					value = 0x32f7
+				}
+				if pixelType == PixelTypeFloat {
+					Write(want, float16.Frombits(value).Float32())
+				} else {
+					Write(want, value)
+				}
+			}
+		}
+		if !bytes.Equal(buffer.Bytes(), want.Bytes()) {
+			t.Fatalf("%s: got % x, want % x", pixelType, buffer.Bytes(), want.Bytes())
+		}
+	}
+}
+
+func TestDwaDecompressLossyDCTLinear(t *testing.T) {
+	channel := testChannel("Y", PixelTypeHalf, 1, 1)
+	channel.Linear = true
+	channels := ChannelList{channel}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 7, YMax: 7}
+
+	// A run of one zero followed by the coefficient 8.0 puts it at the
+	// second position in zig-zag order, which is the first vertical
+	// frequency. The values of linear channels are not converted.
+	compressed := testDwaBlock{
+		ac:        []uint16{0xff01, 0x4800, 0xff00},
+		acHuffman: true,
+		dc:        []uint16{0x0000},
+	}.bytes(t)
+
+	buffer, err := NewDwaDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	for y := 0; y < 8; y++ {
+		want := 8.0 / 4 / math.Sqrt2 * math.Cos(float64(2*y+1)*math.Pi/16)
+		for x := 0; x < 8; x++ {
+			got := testPixelValue(buffer.Bytes(), PixelTypeHalf, y*8+x)
+			if math.Abs(got-want) > 2e-3 {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDwaDecompressCSC(t *testing.T) {
+	// The R, G and B channels are compressed as Y'CbCr. The DC coefficients
+	// of the three components are stored one after the other.
+	const (
+		y  = 8.0 / 8
+		cb = 0.0
+		cr = 1.599609375 / 8 // 0x3e66
+	)
+	want := []float64{
+		dwaToLinearValue(y + 1.8556*cb),
+		dwaToLinearValue(y - 0.1873*cb - 0.4682*cr),
+		dwaToLinearValue(y + 1.5747*cr),
+	}
+
+	for _, pixelType := range []PixelType{PixelTypeHalf, PixelTypeFloat} {
+		channels := ChannelList{
+			testChannel("B", pixelType, 1, 1),
+			testChannel("G", pixelType, 1, 1),
+			testChannel("R", pixelType, 1, 1),
+		}
+		block := Box2i{XMin: 0, YMin: 0, XMax: 7, YMax: 7}
+		compressed := testDwaBlock{
+			ac: []uint16{0xff00, 0xff00, 0xff00},
+			dc: []uint16{0x4800, 0x0000, 0x3e66},
+		}.bytes(t)
+
+		buffer, err := NewDwaDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+		if err != nil {
+			t.Fatalf("%s: error decompressing block: %v", pixelType, err)
+		}
+		for i := 0; i < 8*8*3; i++ {
+			got := testPixelValue(buffer.Bytes(), pixelType, i)
+			channel := (i / 8) % 3
+			if math.Abs(got-want[channel]) > 2e-3*want[channel] {
+				t.Fatalf("%s: channel %s, value %d: got %v, want %v", pixelType, channels[channel].Name, i, got, want[channel])
+			}
+		}
+	}
+}
+
+func TestDwaDecompressRLEAndUnknown(t *testing.T) {
+	// Channels named A are run-length encoded as separate byte planes, from
+	// the least to the most significant byte. Other channels are stored as
+	// is and compressed together.
+	channels := ChannelList{
+		testChannel("A", PixelTypeHalf, 1, 1),
+		testChannel("Z", PixelTypeFloat, 1, 1),
+		testChannel("a", PixelTypeUint, 1, 1),
+		testChannel("id", PixelTypeUint, 1, 1),
+	}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 2, YMax: 1}
+	compressed := testDwaBlock{
+		rle: []byte{
+			// A: 0x3c00, 0x3c01, 0x3c02, 0x3c03, 0x3c04, 0x3c05
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05,
+			0x3c, 0x3c, 0x3c, 0x3c, 0x3c, 0x3c,
+			// a: 0x04030201 times the index of the value
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05,
+			0x00, 0x02, 0x04, 0x06, 0x08, 0x0a,
+			0x00, 0x03, 0x06, 0x09, 0x0c, 0x0f,
+			0x00, 0x04, 0x08, 0x0c, 0x10, 0x14,
+		},
+		unknown: []byte{
+			// Z, line 0 and 1
+			0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x40, 0x40,
+			0x00, 0x00, 0x80, 0x40, 0x00, 0x00, 0xa0, 0x40, 0x00, 0x00, 0xc0, 0x40,
+			// id, line 0 and 1
+			0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+			0x04, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00,
+		},
+	}.bytes(t)
+
+	want := &bytes.Buffer{}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			Write(want, uint16(0x3c00+y*3+x))
+		}
+		for x := 0; x < 3; x++ {
+			Write(want, float32(y*3+x+1))
+		}
+		for x := 0; x < 3; x++ {
+			Write(want, uint32(0x04030201*(y*3+x)))
+		}
+		for x := 0; x < 3; x++ {
+			Write(want, uint32(y*3+x+1))
+		}
+	}
+
+	buffer, err := NewDwaDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), want.Bytes()) {
+		t.Fatalf("got % x, want % x", buffer.Bytes(), want.Bytes())
+	}
+}
+
+func TestDwaDecompressRules(t *testing.T) {
+	// Version 2 data stores its own rules, which here only match the upper
+	// case names, so the lower case channels are stored as is.
+	channels := ChannelList{
+		testChannel("A", PixelTypeHalf, 1, 1),
+		testChannel("Y", PixelTypeHalf, 1, 1),
+		testChannel("a", PixelTypeHalf, 1, 1),
+		testChannel("y", PixelTypeHalf, 1, 1),
+	}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 0}
+	compressed := testDwaBlock{
+		version: 2,
+		rules: []byte{
+			'Y', 0, 0x04, byte(PixelTypeHalf), // LOSSY_DCT, no color index
+			'A', 0, 0x08, byte(PixelTypeHalf), // RLE, no color index
+		},
+		ac:      []uint16{0xff00},
+		dc:      []uint16{0x4800},
+		rle:     []byte{0x01, 0x02, 0x03, 0x04, 0x3c, 0x3c, 0x3c, 0x3c},
+		unknown: []byte{0x00, 0x38, 0x00, 0x39, 0x00, 0x3a, 0x00, 0x3b, 0x00, 0x40, 0x00, 0x41, 0x00, 0x42, 0x00, 0x43},
+	}.bytes(t)
+	want := []byte{
+		0x01, 0x3c, 0x02, 0x3c, 0x03, 0x3c, 0x04, 0x3c,
+		0x00, 0x3c, 0x00, 0x3c, 0x00, 0x3c, 0x00, 0x3c,
+		0x00, 0x38, 0x00, 0x39, 0x00, 0x3a, 0x00, 0x3b,
+		0x00, 0x40, 0x00, 0x41, 0x00, 0x42, 0x00, 0x43,
+	}
+
+	buffer, err := NewDwaDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), want) {
+		t.Fatalf("got % x, want % x", buffer.Bytes(), want)
+	}
+}
+
+func TestReadDwaRules(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rules []byte
+		valid bool
+	}{
+		{name: "no rules", rules: []byte{}, valid: true},
+		{name: "valid rule", rules: []byte{'R', 0, 0x15, byte(PixelTypeFloat)}, valid: true},
+		{name: "invalid color index", rules: []byte{'R', 0, 0x44, byte(PixelTypeHalf)}},
+		{name: "invalid scheme", rules: []byte{'R', 0, 0x0c, byte(PixelTypeHalf)}},
+		{name: "invalid pixel type", rules: []byte{'R', 0, 0x04, 3}},
+		{name: "truncated rule", rules: []byte{'R', 0, 0x04}},
+		{name: "unterminated suffix", rules: []byte{'R', 'G', 'B'}},
+	}
+	for _, tc := range testCases {
+		data := &bytes.Buffer{}
+		Write(data, uint16(len(tc.rules)+2))
+		data.Write(tc.rules)
+		data.WriteString("rest")
+
+		rules, rest, err := readDwaRules(data.Bytes())
+		if !tc.valid {
+			if err == nil {
+				t.Fatalf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: error reading rules: %v", tc.name, err)
+		}
+		if string(rest) != "rest" {
+			t.Fatalf("%s: got remaining data %q", tc.name, rest)
+		}
+		if len(tc.rules) > 0 {
+			want := dwaRule{suffix: "R", scheme: dwaSchemeLossyDCT, pixelType: PixelTypeFloat, cscIndex: 0, caseInsensitive: true}
+			if len(rules) != 1 || rules[0] != want {
+				t.Fatalf("%s: got rules %+v, want %+v", tc.name, rules, want)
+			}
+		}
+	}
+}
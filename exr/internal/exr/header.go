@@ -6,70 +6,148 @@ import (
 	"io"
 )
 
-func ReadHeader(in io.Reader, target *Header) error {
+// ReadHeaders reads the headers of a multipart image, which are terminated
+// by an empty header.
+func ReadHeaders(in io.Reader, target *[]Header) error {
 	for {
+		var header Header
+		empty, err := readHeader(in, &header)
+		if err != nil {
+			return fmt.Errorf("error reading header %d: %w", len(*target), err)
+		}
+		if empty {
+			return nil
+		}
+		*target = append(*target, header)
+	}
+}
+
+// WriteHeaders writes the headers of a multipart image, followed by the
+// empty header that terminates them.
+func WriteHeaders(out io.Writer, headers []Header) error {
+	for i, header := range headers {
+		if err := WriteHeader(out, header); err != nil {
+			return fmt.Errorf("error writing header %d: %w", i, err)
+		}
+	}
+	return WriteNullTerminatedString(out, AttributeName(""))
+}
+
+func ReadHeader(in io.Reader, target *Header) error {
+	_, err := readHeader(in, target)
+	return err
+}
+
+// readHeader reads the attributes of a header and returns whether the
+// header had no attributes at all.
+func readHeader(in io.Reader, target *Header) (bool, error) {
+	for empty := true; ; empty = false {
 		var attributeName AttributeName
 		if err := ReadAttributeName(in, &attributeName); err != nil {
-			return fmt.Errorf("error reading attribute name: %w", err)
+			return false, fmt.Errorf("error reading attribute name: %w", err)
 		}
 		if attributeName == "" {
-			return nil
+			return empty, nil
 		}
 
 		var attributeType AttributeType
 		if err := ReadAttributeType(in, &attributeType); err != nil {
-			return fmt.Errorf("error reading attribute type: %w", err)
+			return false, fmt.Errorf("error reading attribute type: %w", err)
 		}
 
 		var attributeSize int32
 		if err := Read(in, &attributeSize); err != nil {
-			return fmt.Errorf("error reading attribute size: %w", err)
+			return false, fmt.Errorf("error reading attribute size: %w", err)
 		}
 
-		attributeValue := make([]byte, attributeSize)
-		if err := Read(in, &attributeValue); err != nil {
-			return fmt.Errorf("error reading attribute value: %w", err)
+		if attributeSize < 0 {
+			return false, fmt.Errorf("invalid attribute size %d", attributeSize)
 		}
 
+		// The value is copied instead of read into a preallocated slice,
+		// so that a corrupt size cannot cause a huge allocation.
+		attributeBuffer := &bytes.Buffer{}
+		if _, err := io.CopyN(attributeBuffer, in, int64(attributeSize)); err != nil {
+			return false, fmt.Errorf("error reading attribute value: %w", err)
+		}
+		attributeValue := attributeBuffer.Bytes()
+		target.Attributes = append(target.Attributes, Attribute{
+			Name:  attributeName,
+			Type:  attributeType,
+			Value: attributeValue,
+		})
+
 		switch attributeName {
 		case AttributeNameChannels:
 			if attributeType != AttributeTypeChannelList {
-				return fmt.Errorf("incorrect channels attribute type %q", attributeType)
+				return false, fmt.Errorf("incorrect channels attribute type %q", attributeType)
 			}
 			if err := ReadChannelList(bytes.NewReader(attributeValue), &target.Channels); err != nil {
-				return fmt.Errorf("error reading channels: %w", err)
+				return false, fmt.Errorf("error reading channels: %w", err)
 			}
 
 		case AttributeNameCompression:
 			if attributeType != AttributeTypeCompression {
-				return fmt.Errorf("incorrect compression attribute type %q", attributeType)
+				return false, fmt.Errorf("incorrect compression attribute type %q", attributeType)
 			}
 			if err := ReadCompression(bytes.NewReader(attributeValue), &target.Compression); err != nil {
-				return fmt.Errorf("error reading compression: %w", err)
+				return false, fmt.Errorf("error reading compression: %w", err)
 			}
 
 		case AttributeNameDataWindow:
 			if attributeType != AttributeTypeBox2i {
-				return fmt.Errorf("incorrect data window attribute type %q", attributeType)
+				return false, fmt.Errorf("incorrect data window attribute type %q", attributeType)
 			}
 			if err := ReadBox2i(bytes.NewReader(attributeValue), &target.DataWindow); err != nil {
-				return fmt.Errorf("error reading data window: %w", err)
+				return false, fmt.Errorf("error reading data window: %w", err)
 			}
 
 		case AttributeNameDisplayWindow:
 			if attributeType != AttributeTypeBox2i {
-				return fmt.Errorf("incorrect display window attribute type %q", attributeType)
+				return false, fmt.Errorf("incorrect display window attribute type %q", attributeType)
 			}
 			if err := ReadBox2i(bytes.NewReader(attributeValue), &target.DisplayWindow); err != nil {
-				return fmt.Errorf("error reading display window: %w", err)
+				return false, fmt.Errorf("error reading display window: %w", err)
 			}
 
 		case AttributeNameLineOrder:
 			if attributeType != AttributeTypeLineOrder {
-				return fmt.Errorf("incorrect line order attribute type %q", attributeType)
+				return false, fmt.Errorf("incorrect line order attribute type %q", attributeType)
 			}
 			if err := ReadLineOrder(bytes.NewReader(attributeValue), &target.LineOrder); err != nil {
-				return fmt.Errorf("error reading line order: %w", err)
+				return false, fmt.Errorf("error reading line order: %w", err)
+			}
+
+		case AttributeNameTiles:
+			if attributeType != AttributeTypeTileDesc {
+				return false, fmt.Errorf("incorrect tiles attribute type %q", attributeType)
+			}
+			if err := ReadTileDescription(bytes.NewReader(attributeValue), &target.Tiles); err != nil {
+				return false, fmt.Errorf("error reading tiles: %w", err)
+			}
+
+		case AttributeNameName:
+			if attributeType != AttributeTypeString {
+				return false, fmt.Errorf("incorrect name attribute type %q", attributeType)
+			}
+			if err := ReadString(bytes.NewReader(attributeValue), len(attributeValue), &target.Name); err != nil {
+				return false, fmt.Errorf("error reading name: %w", err)
+			}
+
+		case AttributeNameType:
+			if attributeType != AttributeTypeString {
+				return false, fmt.Errorf("incorrect type attribute type %q", attributeType)
+			}
+			if err := ReadPartType(bytes.NewReader(attributeValue), len(attributeValue), &target.Type); err != nil {
+				return false, fmt.Errorf("error reading type: %w", err)
+			}
+
+		case AttributeNameChunkCount:
+			if attributeType != AttributeTypeInt {
+				return false, fmt.Errorf("incorrect chunk count attribute type %q", attributeType)
+			}
+			if err := Read(bytes.NewReader(attributeValue), &target.ChunkCount); err != nil {
+				return false, fmt.Errorf("error reading chunk count: %w", err)
 			}
 
 		default:
@@ -78,10 +156,91 @@ func ReadHeader(in io.Reader, target *Header) error {
 	}
 }
 
+// WriteHeader writes the attributes of a header, followed by the null byte
+// that terminates it. The attributes that are held by the fields of the
+// header are written first, followed by the ones in header.Attributes, which
+// must not repeat them. The name, type and chunkCount attributes, which are
+// required by multipart images, are only written if the header has a name.
+func WriteHeader(out io.Writer, header Header) error {
+	if err := writeAttribute(out, AttributeNameChannels, AttributeTypeChannelList, func(out io.Writer) error {
+		return WriteChannelList(out, header.Channels)
+	}); err != nil {
+		return fmt.Errorf("error writing channels: %w", err)
+	}
+	if err := writeAttribute(out, AttributeNameCompression, AttributeTypeCompression, func(out io.Writer) error {
+		return WriteCompression(out, header.Compression)
+	}); err != nil {
+		return fmt.Errorf("error writing compression: %w", err)
+	}
+	if err := writeAttribute(out, AttributeNameDataWindow, AttributeTypeBox2i, func(out io.Writer) error {
+		return WriteBox2i(out, header.DataWindow)
+	}); err != nil {
+		return fmt.Errorf("error writing data window: %w", err)
+	}
+	if err := writeAttribute(out, AttributeNameDisplayWindow, AttributeTypeBox2i, func(out io.Writer) error {
+		return WriteBox2i(out, header.DisplayWindow)
+	}); err != nil {
+		return fmt.Errorf("error writing display window: %w", err)
+	}
+	if err := writeAttribute(out, AttributeNameLineOrder, AttributeTypeLineOrder, func(out io.Writer) error {
+		return WriteLineOrder(out, header.LineOrder)
+	}); err != nil {
+		return fmt.Errorf("error writing line order: %w", err)
+	}
+	if header.Type.IsTiled() {
+		if err := writeAttribute(out, AttributeNameTiles, AttributeTypeTileDesc, func(out io.Writer) error {
+			return WriteTileDescription(out, header.Tiles)
+		}); err != nil {
+			return fmt.Errorf("error writing tiles: %w", err)
+		}
+	}
+	if header.Name != "" {
+		if err := writeAttribute(out, AttributeNameName, AttributeTypeString, func(out io.Writer) error {
+			return WriteString(out, header.Name)
+		}); err != nil {
+			return fmt.Errorf("error writing name: %w", err)
+		}
+		if err := writeAttribute(out, AttributeNameType, AttributeTypeString, func(out io.Writer) error {
+			return WritePartType(out, header.Type)
+		}); err != nil {
+			return fmt.Errorf("error writing type: %w", err)
+		}
+		if err := writeAttribute(out, AttributeNameChunkCount, AttributeTypeInt, func(out io.Writer) error {
+			return Write(out, header.ChunkCount)
+		}); err != nil {
+			return fmt.Errorf("error writing chunk count: %w", err)
+		}
+	}
+	for _, attribute := range header.Attributes {
+		if err := WriteAttribute(out, attribute); err != nil {
+			return fmt.Errorf("error writing attribute %q: %w", attribute.Name, err)
+		}
+	}
+	return WriteNullTerminatedString(out, AttributeName(""))
+}
+
+// writeAttribute writes an attribute whose value is produced by write.
+func writeAttribute(out io.Writer, name AttributeName, attributeType AttributeType, write func(out io.Writer) error) error {
+	valueBuffer := &bytes.Buffer{}
+	if err := write(valueBuffer); err != nil {
+		return err
+	}
+	return WriteAttribute(out, Attribute{
+		Name:  name,
+		Type:  attributeType,
+		Value: valueBuffer.Bytes(),
+	})
+}
+
 type Header struct {
 	Channels      ChannelList
 	Compression   Compression
 	DataWindow    Box2i
 	DisplayWindow Box2i
 	LineOrder     LineOrder
+	Tiles         TileDescription
+	Name          string
+	Type          PartType
+	ChunkCount    int32
+	Attributes    []Attribute
 }
@@ -0,0 +1,503 @@
+package exr
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+)
+
+// The Huffman coding implemented here follows the one used by the PIZ
+// compression in the OpenEXR reference implementation (ImfHuf.cpp).
+
+const (
+	hufEncBits = 16                    // literal (value) bit length
+	hufDecBits = 14                    // decoding bit size (>= 8)
+	hufEncSize = (1 << hufEncBits) + 1 // encoding table size
+	hufDecSize = 1 << hufDecBits       // decoding table size
+	hufDecMask = hufDecSize - 1
+
+	hufShortZeroCodeRun = 59
+	hufLongZeroCodeRun  = 63
+	hufShortestLongRun  = 2 + hufLongZeroCodeRun - hufShortZeroCodeRun
+	hufLongestLongRun   = 255 + hufShortestLongRun
+
+	hufMaxCodeLength = 58
+	hufHeaderSize    = 20
+)
+
+type hufDec struct {
+	len  int   // length of the short code, zero if long code
+	lit  int   // symbol of the short code
+	long []int // symbols of the long codes sharing this prefix
+}
+
+func hufLength(code uint64) int {
+	return int(code & 63)
+}
+
+func hufCode(code uint64) uint64 {
+	return code >> 6
+}
+
+// hufCanonicalCodeTable replaces the code lengths in hcode with
+// (code << 6 | length) canonical code entries.
+func hufCanonicalCodeTable(hcode []uint64) {
+	var n [hufMaxCodeLength + 1]uint64
+	for i := 0; i < hufEncSize; i++ {
+		n[hcode[i]]++
+	}
+	var c uint64
+	for i := hufMaxCodeLength; i > 0; i-- {
+		nc := (c + n[i]) >> 1
+		n[i] = c
+		c = nc
+	}
+	for i := 0; i < hufEncSize; i++ {
+		l := hcode[i]
+		if l > 0 {
+			hcode[i] = l | (n[l] << 6)
+			n[l]++
+		}
+	}
+}
+
+type hufBitReader struct {
+	data []byte
+	c    uint64
+	lc   int
+}
+
+func (r *hufBitReader) fill() error {
+	if len(r.data) == 0 {
+		return fmt.Errorf("unexpected end of huffman data")
+	}
+	r.c = (r.c << 8) | uint64(r.data[0])
+	r.data = r.data[1:]
+	r.lc += 8
+	return nil
+}
+
+func (r *hufBitReader) bits(n int) (uint64, error) {
+	for r.lc < n {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	r.lc -= n
+	return (r.c >> r.lc) & ((1 << n) - 1), nil
+}
+
+// hufUnpackEncTable reads a packed encoding table from data and returns the
+// canonical codes for the symbols in the range [im, iM].
+func hufUnpackEncTable(data []byte, im, iM int) ([]uint64, []byte, error) {
+	hcode := make([]uint64, hufEncSize)
+	reader := &hufBitReader{
+		data: data,
+	}
+	for ; im <= iM; im++ {
+		l, err := reader.bits(6)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading code length: %w", err)
+		}
+		hcode[im] = l
+		switch {
+		case l == hufLongZeroCodeRun:
+			run, err := reader.bits(8)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error reading zero run length: %w", err)
+			}
+			zerun := int(run) + hufShortestLongRun
+			if im+zerun > iM+1 {
+				return nil, nil, fmt.Errorf("huffman table too long")
+			}
+			for ; zerun > 0; zerun-- {
+				hcode[im] = 0
+				im++
+			}
+			im--
+		case l >= hufShortZeroCodeRun:
+			zerun := int(l) - hufShortZeroCodeRun + 2
+			if im+zerun > iM+1 {
+				return nil, nil, fmt.Errorf("huffman table too long")
+			}
+			for ; zerun > 0; zerun-- {
+				hcode[im] = 0
+				im++
+			}
+			im--
+		}
+	}
+	hufCanonicalCodeTable(hcode)
+	return hcode, reader.data, nil
+}
+
+// hufBuildDecTable builds a decoding table from the encoding table hcode.
+// Short codes are resolved with a single table access, whereas long codes
+// require a secondary search.
+func hufBuildDecTable(hcode []uint64, im, iM int) ([]hufDec, error) {
+	hdec := make([]hufDec, hufDecSize)
+	for ; im <= iM; im++ {
+		c := hufCode(hcode[im])
+		l := hufLength(hcode[im])
+		if c>>l != 0 {
+			return nil, fmt.Errorf("invalid huffman table entry")
+		}
+		if l > hufDecBits {
+			pl := &hdec[c>>(l-hufDecBits)]
+			if pl.len != 0 {
+				return nil, fmt.Errorf("invalid huffman table entry")
+			}
+			pl.long = append(pl.long, im)
+		} else if l != 0 {
+			base := c << (hufDecBits - l)
+			for i := uint64(0); i < 1<<(hufDecBits-l); i++ {
+				pl := &hdec[base+i]
+				if pl.len != 0 || pl.long != nil {
+					return nil, fmt.Errorf("invalid huffman table entry")
+				}
+				pl.len = l
+				pl.lit = im
+			}
+		}
+	}
+	return hdec, nil
+}
+
+type hufDecoder struct {
+	reader hufBitReader
+	rlc    int
+	out    []uint16
+	n      int
+}
+
+func (d *hufDecoder) emit(symbol int) error {
+	if symbol == d.rlc {
+		if d.reader.lc < 8 {
+			if err := d.reader.fill(); err != nil {
+				return err
+			}
+		}
+		d.reader.lc -= 8
+		count := int(byte(d.reader.c >> d.reader.lc))
+		if d.n+count > len(d.out) {
+			return fmt.Errorf("too much huffman data")
+		}
+		if d.n == 0 {
+			return fmt.Errorf("not enough huffman data")
+		}
+		value := d.out[d.n-1]
+		for ; count > 0; count-- {
+			d.out[d.n] = value
+			d.n++
+		}
+		return nil
+	}
+	if d.n >= len(d.out) {
+		return fmt.Errorf("too much huffman data")
+	}
+	d.out[d.n] = uint16(symbol)
+	d.n++
+	return nil
+}
+
+// hufDecode decodes nBits bits of data into out, based on the encoding
+// and decoding tables.
+func hufDecode(hcode []uint64, hdec []hufDec, data []byte, nBits int, rlc int, out []uint16) error {
+	d := &hufDecoder{
+		reader: hufBitReader{
+			data: data[:(nBits+7)/8],
+		},
+		rlc: rlc,
+		out: out,
+	}
+	r := &d.reader
+	for len(r.data) > 0 {
+		if err := r.fill(); err != nil {
+			return err
+		}
+		for r.lc >= hufDecBits {
+			pl := hdec[(r.c>>(r.lc-hufDecBits))&hufDecMask]
+			if pl.len != 0 {
+				r.lc -= pl.len
+				if err := d.emit(pl.lit); err != nil {
+					return err
+				}
+				continue
+			}
+			if pl.long == nil {
+				return fmt.Errorf("invalid huffman code")
+			}
+			found := false
+			for _, symbol := range pl.long {
+				l := hufLength(hcode[symbol])
+				for r.lc < l && len(r.data) > 0 {
+					if err := r.fill(); err != nil {
+						return err
+					}
+				}
+				if r.lc >= l && hufCode(hcode[symbol]) == (r.c>>(r.lc-l))&((1<<l)-1) {
+					r.lc -= l
+					if err := d.emit(symbol); err != nil {
+						return err
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("invalid huffman code")
+			}
+		}
+	}
+
+	// get remaining (short) codes
+	i := (8 - nBits) & 7
+	r.c >>= i
+	r.lc -= i
+	for r.lc > 0 {
+		pl := hdec[(r.c<<(hufDecBits-r.lc))&hufDecMask]
+		if pl.len == 0 || pl.len > r.lc {
+			return fmt.Errorf("invalid huffman code")
+		}
+		r.lc -= pl.len
+		if err := d.emit(pl.lit); err != nil {
+			return err
+		}
+	}
+	if d.n != len(out) {
+		return fmt.Errorf("not enough huffman data")
+	}
+	return nil
+}
+
+// hufUncompress decodes the Huffman compressed data into out, which must
+// have the exact size of the uncompressed data.
+func hufUncompress(data []byte, out []uint16) error {
+	if len(data) == 0 {
+		if len(out) != 0 {
+			return fmt.Errorf("not enough huffman data")
+		}
+		return nil
+	}
+	if len(data) < hufHeaderSize {
+		return fmt.Errorf("huffman header too short")
+	}
+	im := int(binary.LittleEndian.Uint32(data[0:]))
+	iM := int(binary.LittleEndian.Uint32(data[4:]))
+	nBits := int(binary.LittleEndian.Uint32(data[12:]))
+	if im < 0 || im >= hufEncSize || iM < 0 || iM >= hufEncSize || im > iM {
+		return fmt.Errorf("invalid huffman table size")
+	}
+
+	hcode, rest, err := hufUnpackEncTable(data[hufHeaderSize:], im, iM)
+	if err != nil {
+		return fmt.Errorf("error unpacking huffman table: %w", err)
+	}
+	if nBits < 0 || nBits > 8*len(rest) {
+		return fmt.Errorf("invalid huffman bit count %d", nBits)
+	}
+	hdec, err := hufBuildDecTable(hcode, im, iM)
+	if err != nil {
+		return fmt.Errorf("error building huffman table: %w", err)
+	}
+	return hufDecode(hcode, hdec, rest, nBits, iM, out)
+}
+
+// hufFreqHeap is a min-heap of symbols, ordered by their frequencies.
+type hufFreqHeap struct {
+	symbols []int
+	frq     []uint64
+}
+
+func (h *hufFreqHeap) Len() int {
+	return len(h.symbols)
+}
+
+func (h *hufFreqHeap) Less(i, j int) bool {
+	return h.frq[h.symbols[i]] < h.frq[h.symbols[j]]
+}
+
+func (h *hufFreqHeap) Swap(i, j int) {
+	h.symbols[i], h.symbols[j] = h.symbols[j], h.symbols[i]
+}
+
+func (h *hufFreqHeap) Push(x any) {
+	h.symbols = append(h.symbols, x.(int))
+}
+
+func (h *hufFreqHeap) Pop() any {
+	last := len(h.symbols) - 1
+	symbol := h.symbols[last]
+	h.symbols = h.symbols[:last]
+	return symbol
+}
+
+// hufBuildEncTable replaces the symbol frequencies in frq with canonical
+// codes and returns the range [im, iM] of symbols that have a code. The
+// symbol iM is an additional one that is used for run-length encoding.
+func hufBuildEncTable(frq []uint64) (int, int) {
+	// Symbols that belong to the same subtree are linked in a circular
+	// list, so that the lengths of their codes can be increased together
+	// whenever two subtrees are merged.
+	hlink := make([]int, hufEncSize)
+	fHeap := &hufFreqHeap{
+		frq: frq,
+	}
+	im := 0
+	for frq[im] == 0 {
+		im++
+	}
+	iM := im
+	for i := im; i < hufEncSize; i++ {
+		hlink[i] = i
+		if frq[i] != 0 {
+			fHeap.symbols = append(fHeap.symbols, i)
+			iM = i
+		}
+	}
+
+	// add a pseudo symbol, with a frequency count of 1, for run-length
+	// encoding
+	iM++
+	frq[iM] = 1
+	fHeap.symbols = append(fHeap.symbols, iM)
+	heap.Init(fHeap)
+
+	scode := make([]uint64, hufEncSize)
+	for fHeap.Len() > 1 {
+		mm := heap.Pop(fHeap).(int)
+		m := heap.Pop(fHeap).(int)
+		frq[m] += frq[mm]
+		heap.Push(fHeap, m)
+
+		// add a bit to all codes in the first list and merge the lists
+		for j := m; ; j = hlink[j] {
+			scode[j]++
+			if hlink[j] == j {
+				hlink[j] = mm
+				break
+			}
+		}
+		// add a bit to all codes in the second list
+		for j := mm; ; j = hlink[j] {
+			scode[j]++
+			if hlink[j] == j {
+				break
+			}
+		}
+	}
+
+	hufCanonicalCodeTable(scode)
+	copy(frq, scode)
+	return im, iM
+}
+
+type hufBitWriter struct {
+	data []byte
+	c    uint64
+	lc   int
+}
+
+func (w *hufBitWriter) bits(n int, bits uint64) {
+	w.c <<= n
+	w.lc += n
+	w.c |= bits
+	for w.lc >= 8 {
+		w.lc -= 8
+		w.data = append(w.data, byte(w.c>>w.lc))
+	}
+}
+
+func (w *hufBitWriter) code(code uint64) {
+	w.bits(hufLength(code), hufCode(code))
+}
+
+// flush writes the remaining bits, padded with zeros to a whole byte.
+func (w *hufBitWriter) flush() {
+	if w.lc > 0 {
+		w.data = append(w.data, byte(w.c<<(8-w.lc)))
+	}
+}
+
+// hufPackEncTable packs the lengths of the codes in the range [im, iM] of
+// hcode, using run-length encoding for codes that are not used.
+func hufPackEncTable(hcode []uint64, im, iM int) []byte {
+	writer := &hufBitWriter{}
+	for ; im <= iM; im++ {
+		l := hufLength(hcode[im])
+		if l == 0 {
+			zerun := 1
+			for im < iM && zerun < hufLongestLongRun {
+				if hufLength(hcode[im+1]) > 0 {
+					break
+				}
+				im++
+				zerun++
+			}
+			if zerun >= 2 {
+				if zerun >= hufShortestLongRun {
+					writer.bits(6, hufLongZeroCodeRun)
+					writer.bits(8, uint64(zerun-hufShortestLongRun))
+				} else {
+					writer.bits(6, uint64(hufShortZeroCodeRun+zerun-2))
+				}
+				continue
+			}
+		}
+		writer.bits(6, uint64(l))
+	}
+	writer.flush()
+	return writer.data
+}
+
+// hufSendCode writes the code of a symbol that is repeated runCount more
+// times, using the run-length code if that is shorter.
+func hufSendCode(writer *hufBitWriter, sCode uint64, runCount int, runCode uint64) {
+	if hufLength(sCode)+hufLength(runCode)+8 < hufLength(sCode)*runCount {
+		writer.code(sCode)
+		writer.code(runCode)
+		writer.bits(8, uint64(runCount))
+		return
+	}
+	for ; runCount >= 0; runCount-- {
+		writer.code(sCode)
+	}
+}
+
+// hufCompress returns the Huffman compressed form of the values in raw,
+// which can be decoded with hufUncompress.
+func hufCompress(raw []uint16) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	hcode := make([]uint64, hufEncSize)
+	for _, value := range raw {
+		hcode[value]++
+	}
+	im, iM := hufBuildEncTable(hcode)
+	table := hufPackEncTable(hcode, im, iM)
+
+	writer := &hufBitWriter{}
+	s := raw[0]
+	cs := 0
+	for _, value := range raw[1:] {
+		if s == value && cs < 255 {
+			cs++
+		} else {
+			hufSendCode(writer, hcode[s], cs, hcode[iM])
+			cs = 0
+		}
+		s = value
+	}
+	hufSendCode(writer, hcode[s], cs, hcode[iM])
+	nBits := 8*len(writer.data) + writer.lc
+	writer.flush()
+
+	out := make([]byte, hufHeaderSize, hufHeaderSize+len(table)+len(writer.data))
+	binary.LittleEndian.PutUint32(out[0:], uint32(im))
+	binary.LittleEndian.PutUint32(out[4:], uint32(iM))
+	binary.LittleEndian.PutUint32(out[8:], uint32(len(table)))
+	binary.LittleEndian.PutUint32(out[12:], uint32(nBits))
+	out = append(out, table...)
+	return append(out, writer.data...)
+}
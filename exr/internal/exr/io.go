@@ -13,6 +13,10 @@ func Read(in io.Reader, data any) error {
 	return binary.Read(in, order, data)
 }
 
+func Write(out io.Writer, data any) error {
+	return binary.Write(out, order, data)
+}
+
 func ReadNullTerminatedString[T ~string](in io.Reader, target *T) error {
 	var buffer []byte
 	for {
@@ -28,3 +32,27 @@ func ReadNullTerminatedString[T ~string](in io.Reader, target *T) error {
 	*target = T(buffer)
 	return nil
 }
+
+func WriteNullTerminatedString[T ~string](out io.Writer, value T) error {
+	if _, err := io.WriteString(out, string(value)); err != nil {
+		return err
+	}
+	return Write(out, byte(0x00))
+}
+
+// ReadString reads a string that is not null terminated and has the
+// specified size.
+func ReadString[T ~string](in io.Reader, size int, target *T) error {
+	buffer := make([]byte, size)
+	if _, err := io.ReadFull(in, buffer); err != nil {
+		return err
+	}
+	*target = T(buffer)
+	return nil
+}
+
+// WriteString writes a string without a null terminator.
+func WriteString[T ~string](out io.Writer, value T) error {
+	_, err := io.WriteString(out, string(value))
+	return err
+}
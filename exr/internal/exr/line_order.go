@@ -9,6 +9,10 @@ func ReadLineOrder(in io.Reader, target *LineOrder) error {
 	return Read(in, target)
 }
 
+func WriteLineOrder(out io.Writer, lineOrder LineOrder) error {
+	return Write(out, lineOrder)
+}
+
 const (
 	LineOrderIncreasingY LineOrder = 0
 	LineOrderDecreasingY LineOrder = 1
@@ -17,6 +21,17 @@ const (
 
 type LineOrder uint8
 
+// Validate checks whether the line order is one of the line orders that
+// are defined by the OpenEXR specification.
+func (o LineOrder) Validate() error {
+	switch o {
+	case LineOrderIncreasingY, LineOrderDecreasingY, LineOrderRandomY:
+		return nil
+	default:
+		return fmt.Errorf("unsupported line order %q", o)
+	}
+}
+
 func (o LineOrder) String() string {
 	switch o {
 	case LineOrderIncreasingY:
@@ -16,6 +16,10 @@ func ReadMagic(in io.Reader, target *Magic) error {
 	return Read(in, target)
 }
 
+func WriteMagic(out io.Writer, magic Magic) error {
+	return Write(out, magic)
+}
+
 type Magic [4]byte
 
 func (m Magic) IsCorrect() bool {
@@ -0,0 +1,82 @@
+package exr
+
+import (
+	"fmt"
+	"io"
+)
+
+func ReadPartType(in io.Reader, size int, target *PartType) error {
+	var value string
+	if err := ReadString(in, size, &value); err != nil {
+		return err
+	}
+	*target = PartType(value)
+	return nil
+}
+
+func WritePartType(out io.Writer, partType PartType) error {
+	return WriteString(out, partType)
+}
+
+const (
+	PartTypeScanLine     PartType = "scanlineimage"
+	PartTypeTiled        PartType = "tiledimage"
+	PartTypeDeepScanLine PartType = "deepscanline"
+	PartTypeDeepTiled    PartType = "deeptile"
+)
+
+type PartType string
+
+// IsDeep returns whether the part type is one that holds deep data.
+func (t PartType) IsDeep() bool {
+	return t == PartTypeDeepScanLine || t == PartTypeDeepTiled
+}
+
+// IsTiled returns whether the part type is one that stores its data
+// in tiles.
+func (t PartType) IsTiled() bool {
+	return t == PartTypeTiled || t == PartTypeDeepTiled
+}
+
+// IsKnown returns whether the part type is one of the types that are
+// defined by the OpenEXR specification.
+func (t PartType) IsKnown() bool {
+	switch t {
+	case PartTypeScanLine, PartTypeTiled, PartTypeDeepScanLine, PartTypeDeepTiled:
+		return true
+	default:
+		return false
+	}
+}
+
+// VersionPartType returns the part type of a single-part image, based on
+// the flags of its version.
+func VersionPartType(version Version) PartType {
+	switch {
+	case version.HasFlag(FlagNonImage) && version.HasFlag(FlagSingleTile):
+		return PartTypeDeepTiled
+	case version.HasFlag(FlagNonImage):
+		return PartTypeDeepScanLine
+	case version.HasFlag(FlagSingleTile):
+		return PartTypeTiled
+	default:
+		return PartTypeScanLine
+	}
+}
+
+func ReadPartNumber(in io.Reader, partCount int, target *int32) error {
+	if err := Read(in, target); err != nil {
+		return fmt.Errorf("error reading part number: %w", err)
+	}
+	if *target < 0 || int(*target) >= partCount {
+		return fmt.Errorf("invalid part number %d", *target)
+	}
+	return nil
+}
+
+func WritePartNumber(out io.Writer, part int32) error {
+	if err := Write(out, part); err != nil {
+		return fmt.Errorf("error writing part number: %w", err)
+	}
+	return nil
+}
@@ -8,8 +8,7 @@ import (
 )
 
 type PixelData interface {
-	LineSize() int32
-	ReadLine(in io.Reader, y int32) error
+	ReadLine(in io.Reader, xMin, xMax, y int32) error
 	Float32(x, y int) float32
 }
 
@@ -23,11 +22,7 @@ type nopPixelData struct {
 	value float32
 }
 
-func (d *nopPixelData) LineSize() int32 {
-	return 0
-}
-
-func (d *nopPixelData) ReadLine(in io.Reader, y int32) error {
+func (d *nopPixelData) ReadLine(in io.Reader, xMin, xMax, y int32) error {
 	return fmt.Errorf("cannot read into nop pixel data")
 }
 
@@ -37,20 +32,17 @@ func (d *nopPixelData) Float32(x, y int) float32 {
 
 func NewUint32PixelData(window Box2i, xSampling, ySampling int32) PixelData {
 	return &uint32PixelData{
-		width: window.Width() / xSampling,
+		xSampling: xSampling,
 	}
 }
 
 type uint32PixelData struct {
-	width int32
-}
-
-func (d *uint32PixelData) LineSize() int32 {
-	return d.width * 4
+	xSampling int32
 }
 
-func (d *uint32PixelData) ReadLine(in io.Reader, y int32) error {
-	if _, err := io.CopyN(io.Discard, in, int64(d.width)*4); err != nil {
+func (d *uint32PixelData) ReadLine(in io.Reader, xMin, xMax, y int32) error {
+	count := NumSamples(d.xSampling, xMin, xMax)
+	if _, err := io.CopyN(io.Discard, in, int64(count)*4); err != nil {
 		return fmt.Errorf("error reading uint32 pixel slice: %w", err)
 	}
 	return nil
@@ -67,7 +59,7 @@ func NewFloat16PixelData(window Box2i, xSampling, ySampling int32) PixelData {
 		window:    window,
 		xSampling: xSampling,
 		ySampling: ySampling,
-		pixels:    make([]float16.Float16, width*height),
+		pixels:    make([]float16.Float16, int(width)*int(height)),
 	}
 }
 
@@ -78,16 +70,15 @@ type float16PixelData struct {
 	pixels    []float16.Float16
 }
 
-func (d *float16PixelData) LineSize() int32 {
-	width := d.window.Width() / d.xSampling
-	return width * 2
-}
-
-func (d *float16PixelData) ReadLine(in io.Reader, y int32) error {
-	width := d.window.Width() / d.xSampling
-	y = (y - d.window.YMin) / d.ySampling
-	offset := y * width
-	if err := Read(in, d.pixels[offset:offset+width:offset+width]); err != nil {
+func (d *float16PixelData) ReadLine(in io.Reader, xMin, xMax, y int32) error {
+	offset, skip, count, total := lineSpan(d.window, d.xSampling, d.ySampling, xMin, xMax, y)
+	if err := skipBytes(in, skip*2); err != nil {
+		return fmt.Errorf("error reading float16 pixel slice: %w", err)
+	}
+	if err := Read(in, d.pixels[offset:offset+count:offset+count]); err != nil {
+		return fmt.Errorf("error reading float16 pixel slice: %w", err)
+	}
+	if err := skipBytes(in, (total-skip-count)*2); err != nil {
 		return fmt.Errorf("error reading float16 pixel slice: %w", err)
 	}
 	return nil
@@ -98,7 +89,7 @@ func (d *float16PixelData) Float32(x, y int) float32 {
 	offY := (int32(y) - d.window.YMin) / d.ySampling
 	width := d.window.Width() / d.xSampling
 
-	value := d.pixels[offX+width*offY]
+	value := d.pixels[int(offX)+int(width)*int(offY)]
 	if value.IsInf(0) {
 		value = float16.Frombits(uint16(0x7bff)) // max value
 	}
@@ -115,7 +106,18 @@ func NewFloat32PixelData(window Box2i, xSampling, ySampling int32) PixelData {
 		window:    window,
 		xSampling: xSampling,
 		ySampling: ySampling,
-		pixels:    make([]float32, width*height),
+		pixels:    make([]float32, int(width)*int(height)),
+	}
+}
+
+// NewFloat32PixelDataFromPixels creates a PixelData that uses the specified
+// pixels, which are stored row by row and cover the whole window.
+func NewFloat32PixelDataFromPixels(window Box2i, pixels []float32) PixelData {
+	return &float32PixelData{
+		window:    window,
+		xSampling: 1,
+		ySampling: 1,
+		pixels:    pixels,
 	}
 }
 
@@ -126,16 +128,15 @@ type float32PixelData struct {
 	pixels    []float32
 }
 
-func (d *float32PixelData) LineSize() int32 {
-	width := d.window.Width() / d.xSampling
-	return width * 4
-}
-
-func (d *float32PixelData) ReadLine(in io.Reader, y int32) error {
-	width := d.window.Width() / d.xSampling
-	y = (y - d.window.YMin) / d.ySampling
-	offset := y * width
-	if err := Read(in, d.pixels[offset:offset+width:offset+width]); err != nil {
+func (d *float32PixelData) ReadLine(in io.Reader, xMin, xMax, y int32) error {
+	offset, skip, count, total := lineSpan(d.window, d.xSampling, d.ySampling, xMin, xMax, y)
+	if err := skipBytes(in, skip*4); err != nil {
+		return fmt.Errorf("error reading float32 pixel slice: %w", err)
+	}
+	if err := Read(in, d.pixels[offset:offset+count:offset+count]); err != nil {
+		return fmt.Errorf("error reading float32 pixel slice: %w", err)
+	}
+	if err := skipBytes(in, (total-skip-count)*4); err != nil {
 		return fmt.Errorf("error reading float32 pixel slice: %w", err)
 	}
 	return nil
@@ -145,5 +146,49 @@ func (d *float32PixelData) Float32(x, y int) float32 {
 	offX := (int32(x) - d.window.XMin) / d.xSampling
 	offY := (int32(y) - d.window.YMin) / d.ySampling
 	width := d.window.Width() / d.xSampling
-	return d.pixels[offX+width*offY]
+	return d.pixels[int(offX)+int(width)*int(offY)]
+}
+
+// lineSpan returns where the samples of line y, within the range
+// [xMin, xMax], go in a pixel slice that covers window. Out of the total
+// samples of the line, the first skip ones and the ones that follow the
+// next count are outside of the window and need to be skipped.
+func lineSpan(window Box2i, xSampling, ySampling, xMin, xMax, y int32) (offset, skip, count, total int) {
+	total = int(NumSamples(xSampling, xMin, xMax))
+	if y < window.YMin || y > window.YMax {
+		return 0, total, 0, total
+	}
+
+	lineFirst := Div(xMin, xSampling)
+	if lineFirst*xSampling < xMin {
+		lineFirst++
+	}
+	lineLast := Div(xMax, xSampling)
+	windowFirst := Div(window.XMin, xSampling)
+	windowLast := Div(window.XMax, xSampling)
+
+	first, last := lineFirst, lineLast
+	if windowFirst > first {
+		first = windowFirst
+	}
+	if windowLast < last {
+		last = windowLast
+	}
+	if first > last {
+		return 0, total, 0, total
+	}
+
+	width := int(windowLast - windowFirst + 1)
+	offY := int(Div(y, ySampling) - Div(window.YMin, ySampling))
+	offset = int(first-windowFirst) + width*offY
+	return offset, int(first - lineFirst), int(last - first + 1), total
+}
+
+// skipBytes discards the next count bytes of in.
+func skipBytes(in io.Reader, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	_, err := io.CopyN(io.Discard, in, int64(count))
+	return err
 }
@@ -0,0 +1,242 @@
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	pizUShortRange = 1 << 16
+	pizBitmapSize  = pizUShortRange >> 3
+)
+
+func NewPizDecompressor(channels ChannelList) Decompressor {
+	return &pizDecompressor{
+		channels: channels,
+	}
+}
+
+type pizDecompressor struct {
+	channels ChannelList
+}
+
+type pizChannelData struct {
+	start int
+	nx    int
+	ny    int
+	ys    int32
+	size  int
+}
+
+// newPizChannelData returns the layout of the values of each channel within
+// the specified block, along with the total number of values.
+func newPizChannelData(channels ChannelList, block Box2i) ([]pizChannelData, int) {
+	channelData := make([]pizChannelData, len(channels))
+	valueCount := 0
+	for i, channel := range channels {
+		cd := &channelData[i]
+		cd.start = valueCount
+		cd.nx = int(NumSamples(channel.XSampling, block.XMin, block.XMax))
+		cd.ny = int(NumSamples(channel.YSampling, block.YMin, block.YMax))
+		cd.ys = channel.YSampling
+		cd.size = channel.PixelType.ByteSize() / PixelTypeHalf.ByteSize()
+		valueCount += cd.nx * cd.ny * cd.size
+	}
+	return channelData, valueCount
+}
+
+func (d *pizDecompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
+	channelData, valueCount := newPizChannelData(d.channels, block)
+
+	in := src.Bytes()
+	if len(in) < 4 {
+		return nil, fmt.Errorf("piz data too short")
+	}
+	minNonZero := int(binary.LittleEndian.Uint16(in[0:]))
+	maxNonZero := int(binary.LittleEndian.Uint16(in[2:]))
+	in = in[4:]
+	if maxNonZero >= pizBitmapSize {
+		return nil, fmt.Errorf("invalid piz bitmap size")
+	}
+
+	bitmap := make([]byte, pizBitmapSize)
+	if minNonZero <= maxNonZero {
+		count := maxNonZero - minNonZero + 1
+		if len(in) < count {
+			return nil, fmt.Errorf("piz bitmap too short")
+		}
+		copy(bitmap[minNonZero:], in[:count])
+		in = in[count:]
+	}
+	lut, maxValue := reverseLutFromBitmap(bitmap)
+
+	if len(in) < 4 {
+		return nil, fmt.Errorf("piz data too short")
+	}
+	length := int(int32(binary.LittleEndian.Uint32(in)))
+	in = in[4:]
+	if length < 0 || length > len(in) {
+		return nil, fmt.Errorf("invalid piz huffman data length %d", length)
+	}
+
+	values := make([]uint16, valueCount)
+	if err := hufUncompress(in[:length], values); err != nil {
+		return nil, fmt.Errorf("error decoding huffman data: %w", err)
+	}
+
+	for _, cd := range channelData {
+		for j := 0; j < cd.size; j++ {
+			wav2Decode(values[cd.start+j:], cd.nx, cd.size, cd.ny, cd.nx*cd.size, maxValue)
+		}
+	}
+
+	for i, value := range values {
+		values[i] = lut[value]
+	}
+
+	out := make([]byte, 2*valueCount)
+	offset := 0
+	for y := block.YMin; y <= block.YMax; y++ {
+		for i := range channelData {
+			cd := &channelData[i]
+			if Mod(y, cd.ys) != 0 {
+				continue
+			}
+			count := cd.nx * cd.size
+			for _, value := range values[cd.start : cd.start+count] {
+				order.PutUint16(out[offset:], value)
+				offset += 2
+			}
+			cd.start += count
+		}
+	}
+	return bytes.NewBuffer(out), nil
+}
+
+func NewPizCompressor(channels ChannelList) Compressor {
+	return &pizCompressor{
+		channels: channels,
+	}
+}
+
+type pizCompressor struct {
+	channels ChannelList
+}
+
+func (c *pizCompressor) Compress(src []byte, block Box2i) ([]byte, error) {
+	channelData, valueCount := newPizChannelData(c.channels, block)
+	if len(src) != 2*valueCount {
+		return nil, fmt.Errorf("invalid block data size %d", len(src))
+	}
+
+	// The values of each channel are gathered from the scan lines, so that
+	// the wavelet transform can be applied to each channel as a whole.
+	values := make([]uint16, valueCount)
+	ends := make([]int, len(channelData))
+	for i, cd := range channelData {
+		ends[i] = cd.start
+	}
+	offset := 0
+	for y := block.YMin; y <= block.YMax; y++ {
+		for i, cd := range channelData {
+			if Mod(y, cd.ys) != 0 {
+				continue
+			}
+			count := cd.nx * cd.size
+			for j := ends[i]; j < ends[i]+count; j++ {
+				values[j] = order.Uint16(src[offset:])
+				offset += 2
+			}
+			ends[i] += count
+		}
+	}
+
+	bitmap, minNonZero, maxNonZero := bitmapFromData(values)
+	lut, maxValue := forwardLutFromBitmap(bitmap)
+	for i, value := range values {
+		values[i] = lut[value]
+	}
+
+	out := &bytes.Buffer{}
+	if err := Write(out, uint16(minNonZero)); err != nil {
+		return nil, fmt.Errorf("error writing minimum non-zero bitmap byte: %w", err)
+	}
+	if err := Write(out, uint16(maxNonZero)); err != nil {
+		return nil, fmt.Errorf("error writing maximum non-zero bitmap byte: %w", err)
+	}
+	if minNonZero <= maxNonZero {
+		if _, err := out.Write(bitmap[minNonZero : maxNonZero+1]); err != nil {
+			return nil, fmt.Errorf("error writing bitmap: %w", err)
+		}
+	}
+
+	for _, cd := range channelData {
+		for j := 0; j < cd.size; j++ {
+			wav2Encode(values[cd.start+j:], cd.nx, cd.size, cd.ny, cd.nx*cd.size, maxValue)
+		}
+	}
+
+	data := hufCompress(values)
+	if err := Write(out, int32(len(data))); err != nil {
+		return nil, fmt.Errorf("error writing huffman data size: %w", err)
+	}
+	if _, err := out.Write(data); err != nil {
+		return nil, fmt.Errorf("error writing huffman data: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// bitmapFromData returns a bitmap of the values that occur in data, except
+// for zero, along with the range of bytes in it that are not zero.
+func bitmapFromData(data []uint16) ([]byte, int, int) {
+	bitmap := make([]byte, pizBitmapSize)
+	for _, value := range data {
+		bitmap[value>>3] |= 1 << (value & 7)
+	}
+	bitmap[0] &^= 1 // zero is not explicitly stored in the bitmap
+
+	minNonZero := pizBitmapSize - 1
+	maxNonZero := 0
+	for i, bits := range bitmap {
+		if bits != 0 {
+			if minNonZero > i {
+				minNonZero = i
+			}
+			if maxNonZero < i {
+				maxNonZero = i
+			}
+		}
+	}
+	return bitmap, minNonZero, maxNonZero
+}
+
+// forwardLutFromBitmap builds a lookup table that maps the values that are
+// present in the bitmap to compacted values and returns it along with the
+// maximum compacted value. It is the inverse of reverseLutFromBitmap.
+func forwardLutFromBitmap(bitmap []byte) ([]uint16, uint16) {
+	lut := make([]uint16, pizUShortRange)
+	k := 0
+	for i := 0; i < pizUShortRange; i++ {
+		if i == 0 || bitmap[i>>3]&(1<<(i&7)) != 0 {
+			lut[i] = uint16(k)
+			k++
+		}
+	}
+	return lut, uint16(k - 1)
+}
+
+// reverseLutFromBitmap builds a lookup table that maps the compacted values
+// back to the original ones and returns it along with the maximum compacted
+// value.
+func reverseLutFromBitmap(bitmap []byte) ([]uint16, uint16) {
+	lut := make([]uint16, pizUShortRange)
+	k := 0
+	for i := 0; i < pizUShortRange; i++ {
+		if i == 0 || bitmap[i>>3]&(1<<(i&7)) != 0 {
+			lut[k] = uint16(i)
+			k++
+		}
+	}
+	return lut, uint16(k - 1)
+}
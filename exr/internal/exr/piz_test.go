@@ -0,0 +1,83 @@
+package exr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPizDecompress(t *testing.T) {
+	// A block of two HALF values of 1.0 (0x3c00), with each step derived by
+	// hand from the PIZ compression of the OpenEXR reference implementation.
+	channels := ChannelList{testChannel("Y", PixelTypeHalf, 1, 1)}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 1, YMax: 0}
+	compressed := []byte{
+		0x80, 0x07, // minimum non-zero bitmap byte: 0x3c00 >> 3
+		0x80, 0x07, // maximum non-zero bitmap byte
+		0x01,                   // bitmap byte 0x780, with the bit of 0x3c00
+		0x17, 0x00, 0x00, 0x00, // length of the huffman data
+		0x01, 0x00, 0x00, 0x00, // first symbol: 0x3c00 maps to 1
+		0x02, 0x00, 0x00, 0x00, // last symbol: the run-length symbol
+		0x02, 0x00, 0x00, 0x00, // length of the packed code table
+		0x02, 0x00, 0x00, 0x00, // number of encoded bits
+		0x00, 0x00, 0x00, 0x00, // unused
+		0x04, 0x10, // code lengths of the two symbols: 1 and 1, in six bits each
+		0x00, // the code 0 of the symbol 1, twice
+	}
+	want := []byte{0x00, 0x3c, 0x00, 0x3c}
+
+	buffer, err := NewPizDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), want) {
+		t.Fatalf("got % x, want % x", buffer.Bytes(), want)
+	}
+
+	data, err := NewPizCompressor(channels).Compress(want, block)
+	if err != nil {
+		t.Fatalf("error compressing block: %v", err)
+	}
+	if !bytes.Equal(data, compressed) {
+		t.Fatalf("got compressed data % x, want % x", data, compressed)
+	}
+}
+
+func TestPizDecompressChannels(t *testing.T) {
+	// FLOAT and UINT values are compressed as two 16-bit values each and
+	// subsampled channels only have values on some of the lines and columns.
+	channels := ChannelList{
+		testChannel("B", PixelTypeHalf, 1, 1),
+		testChannel("G", PixelTypeHalf, 2, 2),
+		testChannel("R", PixelTypeFloat, 1, 2),
+		testChannel("id", PixelTypeUint, 2, 1),
+		testChannel("Z", PixelTypeFloat, 1, 1),
+	}
+	value := func(channel int, x, y int32) float32 {
+		switch channel {
+		case 3:
+			return float32(x/4 + 1000*(y/3))
+		default:
+			return float32(channel) + float32(x)*0.125 - float32(y)*0.25
+		}
+	}
+	blocks := []Box2i{
+		{XMin: 0, YMin: 0, XMax: 31, YMax: 31},
+		{XMin: -3, YMin: 3, XMax: 34, YMax: 34},
+		{XMin: 5, YMin: 7, XMax: 5, YMax: 9},
+		{XMin: 1, YMin: 1, XMax: 40, YMax: 1},
+	}
+	for _, block := range blocks {
+		raw := testBlockData(channels, block, value)
+		compressed, err := NewPizCompressor(channels).Compress(raw, block)
+		if err != nil {
+			t.Fatalf("block %v: error compressing block: %v", block, err)
+		}
+		buffer, err := NewPizDecompressor(channels).Decompress(bytes.NewBuffer(compressed), block)
+		if err != nil {
+			t.Fatalf("block %v: error decompressing block: %v", block, err)
+		}
+		if !bytes.Equal(buffer.Bytes(), raw) {
+			t.Fatalf("block %v: decompressed data does not match", block)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package exr
+
+import (
+	"bytes"
+	"fmt"
+)
+
+func NewPxr24Decompressor(channels ChannelList) Decompressor {
+	return &pxr24Decompressor{
+		channels: channels,
+	}
+}
+
+type pxr24Decompressor struct {
+	channels ChannelList
+}
+
+func (d *pxr24Decompressor) Decompress(src *bytes.Buffer, block Box2i) (*bytes.Buffer, error) {
+	data, err := inflate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for y := block.YMin; y <= block.YMax; y++ {
+		for _, channel := range d.channels {
+			if Mod(y, channel.YSampling) != 0 {
+				continue
+			}
+			n := int(NumSamples(channel.XSampling, block.XMin, block.XMax))
+
+			// Each channel line is stored as separate planes that hold
+			// the most significant to least significant bytes of the
+			// differences between neighbouring pixels.
+			var planeCount int
+			switch channel.PixelType {
+			case PixelTypeUint:
+				planeCount = 4
+			case PixelTypeHalf:
+				planeCount = 2
+			case PixelTypeFloat:
+				planeCount = 3
+			default:
+				return nil, fmt.Errorf("unsupported channel pixel type %q", channel.PixelType)
+			}
+			if len(data) < n*planeCount {
+				return nil, fmt.Errorf("pxr24 data too short")
+			}
+			planes := make([][]byte, planeCount)
+			for i := range planes {
+				planes[i] = data[i*n : (i+1)*n]
+			}
+			data = data[n*planeCount:]
+
+			var (
+				pixel uint32
+				value [4]byte
+			)
+			for j := 0; j < n; j++ {
+				switch channel.PixelType {
+				case PixelTypeUint:
+					pixel += uint32(planes[0][j])<<24 | uint32(planes[1][j])<<16 | uint32(planes[2][j])<<8 | uint32(planes[3][j])
+					order.PutUint32(value[:], pixel)
+					out = append(out, value[:4]...)
+				case PixelTypeHalf:
+					pixel += uint32(planes[0][j])<<8 | uint32(planes[1][j])
+					order.PutUint16(value[:], uint16(pixel))
+					out = append(out, value[:2]...)
+				case PixelTypeFloat:
+					// The float is reconstructed from its 24 most
+					// significant bits.
+					pixel += uint32(planes[0][j])<<24 | uint32(planes[1][j])<<16 | uint32(planes[2][j])<<8
+					order.PutUint32(value[:], pixel)
+					out = append(out, value[:4]...)
+				}
+			}
+		}
+	}
+	return bytes.NewBuffer(out), nil
+}
@@ -0,0 +1,71 @@
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+)
+
+func TestPxr24Decompress(t *testing.T) {
+	channels := ChannelList{
+		testChannel("id", PixelTypeUint, 1, 1),
+		testChannel("Y", PixelTypeHalf, 1, 1),
+		testChannel("Z", PixelTypeFloat, 1, 1),
+	}
+	block := Box2i{XMin: 0, YMin: 0, XMax: 1, YMax: 1}
+
+	// Each channel line holds the differences between neighbouring values,
+	// split into planes from the most to the least significant byte. FLOAT
+	// values only keep their 24 most significant bits, which are rounded.
+	planes := []byte{
+		// line 0, id: 0x00000001, 0x01020304
+		0x00, 0x01,
+		0x00, 0x02,
+		0x00, 0x03,
+		0x01, 0x03,
+		// line 0, Y: 0x3c00, 0x4000
+		0x3c, 0x04,
+		0x00, 0x00,
+		// line 0, Z: 0x3f800000 (1.0), 0x40490fdb (pi) rounded to 0x404910
+		0x3f, 0x00,
+		0x80, 0xc9,
+		0x00, 0x10,
+		// line 1, id: 0x00000005, 0x00000005
+		0x00, 0x00,
+		0x00, 0x00,
+		0x00, 0x00,
+		0x05, 0x00,
+		// line 1, Y: 0xbc00, 0xbc00
+		0xbc, 0x00,
+		0x00, 0x00,
+		// line 1, Z: 0xc0000000 (-2.0), 0x00000000, which wraps around
+		0xc0, 0x40,
+		0x00, 0x00,
+		0x00, 0x00,
+	}
+	want := []byte{
+		0x01, 0x00, 0x00, 0x00, 0x04, 0x03, 0x02, 0x01,
+		0x00, 0x3c, 0x00, 0x40,
+		0x00, 0x00, 0x80, 0x3f, 0x00, 0x10, 0x49, 0x40,
+		0x05, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+		0x00, 0xbc, 0x00, 0xbc,
+		0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	compressed := &bytes.Buffer{}
+	zlibOut := zlib.NewWriter(compressed)
+	if _, err := zlibOut.Write(planes); err != nil {
+		t.Fatal(err)
+	}
+	if err := zlibOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer, err := NewPxr24Decompressor(channels).Decompress(compressed, block)
+	if err != nil {
+		t.Fatalf("error decompressing block: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), want) {
+		t.Fatalf("got % x, want % x", buffer.Bytes(), want)
+	}
+}
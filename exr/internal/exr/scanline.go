@@ -1,54 +1,63 @@
 package exr
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 )
 
-func ReadScanLineBlock(in io.Reader, dataWindow Box2i, compression Compression, decompressor Decompressor, dataChannels []PixelData) error {
-	var yCoordinate int32
-	if err := Read(in, &yCoordinate); err != nil {
+func ReadScanLineChunk(in io.Reader, target *ScanLineChunk) error {
+	if err := Read(in, &target.Y); err != nil {
 		return fmt.Errorf("error reading block y coordinate: %w", err)
 	}
+	return ReadChunkData(in, &target.Data)
+}
 
-	var dataSize int32
-	if err := Read(in, &dataSize); err != nil {
-		return fmt.Errorf("error reading block data size: %w", err)
+func WriteScanLineChunk(out io.Writer, chunk ScanLineChunk) error {
+	if err := Write(out, chunk.Y); err != nil {
+		return fmt.Errorf("error writing block y coordinate: %w", err)
 	}
+	return WriteChunkData(out, chunk.Data)
+}
 
-	buffer := &bytes.Buffer{}
-	if _, err := io.CopyN(buffer, in, int64(dataSize)); err != nil {
-		return fmt.Errorf("error reading block data: %w", err)
-	}
+type ScanLineChunk struct {
+	Y    int32
+	Data []byte
+}
 
-	blockHeight := int32(compression.LineCount())
-	if dataWindow.YMax-yCoordinate+1 < blockHeight {
-		blockHeight = dataWindow.YMax - yCoordinate + 1
+// ScanLineBlock returns the window that is covered by the scan line block
+// that starts at y.
+func ScanLineBlock(dataWindow Box2i, compression Compression, y int32) (Box2i, error) {
+	if y < dataWindow.YMin || y > dataWindow.YMax {
+		return Box2i{}, fmt.Errorf("block y coordinate %d outside of data window", y)
 	}
-
-	if compression == CompressionZIP {
-		uncompressedSize := int32(0)
-		for _, dataChannel := range dataChannels {
-			uncompressedSize += dataChannel.LineSize()
-		}
-		uncompressedSize *= blockHeight
-
-		if uncompressedSize > dataSize {
-			var err error
-			buffer, err = decompressor.Decompress(buffer)
-			if err != nil {
-				return fmt.Errorf("error decompressing block data: %w", err)
-			}
-		}
+	lineCount, err := compression.LineCount()
+	if err != nil {
+		return Box2i{}, err
 	}
+	blockHeight := int32(lineCount)
+	if (int64(y)-int64(dataWindow.YMin))%int64(blockHeight) != 0 {
+		return Box2i{}, fmt.Errorf("block y coordinate %d not at the start of a block", y)
+	}
+	if dataWindow.YMax-y+1 < blockHeight {
+		blockHeight = dataWindow.YMax - y + 1
+	}
+	return Box2i{
+		XMin: dataWindow.XMin,
+		YMin: y,
+		XMax: dataWindow.XMax,
+		YMax: y + blockHeight - 1,
+	}, nil
+}
 
-	for y := yCoordinate; y < yCoordinate+blockHeight; y++ {
-		for _, dataChannel := range dataChannels {
-			if err := dataChannel.ReadLine(buffer, y); err != nil {
-				return fmt.Errorf("error reading scan line: %w", err)
-			}
-		}
-	}
-	return nil
+// ScanLineChunkIndex returns the index in the offset table of the chunk
+// that holds line y.
+func ScanLineChunkIndex(dataWindow Box2i, compression Compression, y int32) (int, error) {
+	if y < dataWindow.YMin || y > dataWindow.YMax {
+		return 0, fmt.Errorf("line %d outside of data window", y)
+	}
+	lineCount, err := compression.LineCount()
+	if err != nil {
+		return 0, err
+	}
+	return (int(y) - int(dataWindow.YMin)) / lineCount, nil
 }
@@ -0,0 +1,320 @@
+package exr
+
+import (
+	"fmt"
+	"io"
+)
+
+func ReadTileDescription(in io.Reader, target *TileDescription) error {
+	if err := Read(in, &target.XSize); err != nil {
+		return fmt.Errorf("error reading x size: %w", err)
+	}
+	if err := Read(in, &target.YSize); err != nil {
+		return fmt.Errorf("error reading y size: %w", err)
+	}
+	var mode uint8
+	if err := Read(in, &mode); err != nil {
+		return fmt.Errorf("error reading mode: %w", err)
+	}
+	target.LevelMode = LevelMode(mode & 0x0F)
+	target.RoundingMode = RoundingMode(mode >> 4)
+	return nil
+}
+
+func WriteTileDescription(out io.Writer, description TileDescription) error {
+	if err := Write(out, description.XSize); err != nil {
+		return fmt.Errorf("error writing x size: %w", err)
+	}
+	if err := Write(out, description.YSize); err != nil {
+		return fmt.Errorf("error writing y size: %w", err)
+	}
+	mode := uint8(description.LevelMode) | uint8(description.RoundingMode)<<4
+	if err := Write(out, mode); err != nil {
+		return fmt.Errorf("error writing mode: %w", err)
+	}
+	return nil
+}
+
+type TileDescription struct {
+	XSize        uint32
+	YSize        uint32
+	LevelMode    LevelMode
+	RoundingMode RoundingMode
+}
+
+// Validate checks whether the tile description is one that can be used
+// for decoding.
+func (d TileDescription) Validate() error {
+	if d.XSize < 1 || d.YSize < 1 || d.XSize > 1<<30 || d.YSize > 1<<30 {
+		return fmt.Errorf("invalid tile size (%d x %d)", d.XSize, d.YSize)
+	}
+	switch d.LevelMode {
+	case LevelModeOne, LevelModeMipmap, LevelModeRipmap:
+	default:
+		return fmt.Errorf("unsupported level mode %q", d.LevelMode)
+	}
+	switch d.RoundingMode {
+	case RoundingModeDown, RoundingModeUp:
+	default:
+		return fmt.Errorf("unsupported rounding mode %q", d.RoundingMode)
+	}
+	return nil
+}
+
+// LevelCountX returns the number of levels in the x direction.
+func (d TileDescription) LevelCountX(dataWindow Box2i) int {
+	switch d.LevelMode {
+	case LevelModeMipmap:
+		size := dataWindow.Width()
+		if dataWindow.Height() > size {
+			size = dataWindow.Height()
+		}
+		return d.RoundingMode.Log2(size) + 1
+	case LevelModeRipmap:
+		return d.RoundingMode.Log2(dataWindow.Width()) + 1
+	default:
+		return 1
+	}
+}
+
+// LevelCountY returns the number of levels in the y direction.
+func (d TileDescription) LevelCountY(dataWindow Box2i) int {
+	switch d.LevelMode {
+	case LevelModeMipmap:
+		return d.LevelCountX(dataWindow)
+	case LevelModeRipmap:
+		return d.RoundingMode.Log2(dataWindow.Height()) + 1
+	default:
+		return 1
+	}
+}
+
+// Levels returns the levels of the image in the order in which their tiles
+// are stored in the file.
+func (d TileDescription) Levels(dataWindow Box2i) []Level {
+	var levels []Level
+	switch d.LevelMode {
+	case LevelModeMipmap:
+		for l := 0; l < d.LevelCountX(dataWindow); l++ {
+			levels = append(levels, Level{X: l, Y: l})
+		}
+	case LevelModeRipmap:
+		for ly := 0; ly < d.LevelCountY(dataWindow); ly++ {
+			for lx := 0; lx < d.LevelCountX(dataWindow); lx++ {
+				levels = append(levels, Level{X: lx, Y: ly})
+			}
+		}
+	default:
+		levels = append(levels, Level{X: 0, Y: 0})
+	}
+	return levels
+}
+
+// HasLevel returns whether the image contains the specified level.
+func (d TileDescription) HasLevel(dataWindow Box2i, level Level) bool {
+	if level.X < 0 || level.X >= d.LevelCountX(dataWindow) {
+		return false
+	}
+	if level.Y < 0 || level.Y >= d.LevelCountY(dataWindow) {
+		return false
+	}
+	return d.LevelMode != LevelModeMipmap || level.X == level.Y
+}
+
+// LevelWindow returns the data window of the specified level.
+func (d TileDescription) LevelWindow(dataWindow Box2i, level Level) Box2i {
+	return Box2i{
+		XMin: dataWindow.XMin,
+		YMin: dataWindow.YMin,
+		XMax: dataWindow.XMin + d.RoundingMode.LevelSize(dataWindow.Width(), level.X) - 1,
+		YMax: dataWindow.YMin + d.RoundingMode.LevelSize(dataWindow.Height(), level.Y) - 1,
+	}
+}
+
+// TileCountX returns the number of tiles in the x direction of a level
+// with the specified data window.
+func (d TileDescription) TileCountX(levelWindow Box2i) int {
+	return int((int64(levelWindow.Width()) + int64(d.XSize) - 1) / int64(d.XSize))
+}
+
+// TileCountY returns the number of tiles in the y direction of a level
+// with the specified data window.
+func (d TileDescription) TileCountY(levelWindow Box2i) int {
+	return int((int64(levelWindow.Height()) + int64(d.YSize) - 1) / int64(d.YSize))
+}
+
+// TileWindow returns the data window of the specified tile within a level
+// with the specified data window.
+func (d TileDescription) TileWindow(levelWindow Box2i, tileX, tileY int32) Box2i {
+	window := Box2i{
+		XMin: levelWindow.XMin + tileX*int32(d.XSize),
+		YMin: levelWindow.YMin + tileY*int32(d.YSize),
+	}
+	window.XMax = window.XMin + int32(d.XSize) - 1
+	window.YMax = window.YMin + int32(d.YSize) - 1
+	if window.XMax > levelWindow.XMax {
+		window.XMax = levelWindow.XMax
+	}
+	if window.YMax > levelWindow.YMax {
+		window.YMax = levelWindow.YMax
+	}
+	return window
+}
+
+// ChunkIndex returns the index in the offset table of the chunk that holds
+// the specified tile of the specified level.
+func (d TileDescription) ChunkIndex(dataWindow Box2i, level Level, tileX, tileY int) int {
+	index := 0
+	for _, current := range d.Levels(dataWindow) {
+		levelWindow := d.LevelWindow(dataWindow, current)
+		if current == level {
+			return index + tileY*d.TileCountX(levelWindow) + tileX
+		}
+		index += d.TileCountX(levelWindow) * d.TileCountY(levelWindow)
+	}
+	return index
+}
+
+// ChunkCount returns the total number of tiles across all levels.
+func (d TileDescription) ChunkCount(dataWindow Box2i) int {
+	count := 0
+	for _, level := range d.Levels(dataWindow) {
+		levelWindow := d.LevelWindow(dataWindow, level)
+		count += d.TileCountX(levelWindow) * d.TileCountY(levelWindow)
+	}
+	return count
+}
+
+type Level struct {
+	X int
+	Y int
+}
+
+const (
+	LevelModeOne    LevelMode = 0
+	LevelModeMipmap LevelMode = 1
+	LevelModeRipmap LevelMode = 2
+)
+
+type LevelMode uint8
+
+func (m LevelMode) String() string {
+	switch m {
+	case LevelModeOne:
+		return "ONE_LEVEL"
+	case LevelModeMipmap:
+		return "MIPMAP_LEVELS"
+	case LevelModeRipmap:
+		return "RIPMAP_LEVELS"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", m)
+	}
+}
+
+const (
+	RoundingModeDown RoundingMode = 0
+	RoundingModeUp   RoundingMode = 1
+)
+
+type RoundingMode uint8
+
+// Log2 returns the base 2 logarithm of x, rounded according to the
+// rounding mode.
+func (m RoundingMode) Log2(x int32) int {
+	y := 0
+	if m == RoundingModeUp {
+		r := 0
+		for x > 1 {
+			if x&1 != 0 {
+				r = 1
+			}
+			y++
+			x >>= 1
+		}
+		return y + r
+	}
+	for x > 1 {
+		y++
+		x >>= 1
+	}
+	return y
+}
+
+// LevelSize returns the size of the specified level, given the size of
+// the base level.
+func (m RoundingMode) LevelSize(size int32, level int) int32 {
+	b := int64(1) << level
+	result := int64(size) / b
+	if m == RoundingModeUp && result*b < int64(size) {
+		result++
+	}
+	if result < 1 {
+		result = 1
+	}
+	return int32(result)
+}
+
+func (m RoundingMode) String() string {
+	switch m {
+	case RoundingModeDown:
+		return "ROUND_DOWN"
+	case RoundingModeUp:
+		return "ROUND_UP"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", m)
+	}
+}
+
+func ReadTileChunk(in io.Reader, target *TileChunk) error {
+	if err := ReadTileCoordinates(in, &target.TileCoordinates); err != nil {
+		return err
+	}
+	return ReadChunkData(in, &target.Data)
+}
+
+func WriteTileChunk(out io.Writer, chunk TileChunk) error {
+	if err := WriteTileCoordinates(out, chunk.TileCoordinates); err != nil {
+		return err
+	}
+	return WriteChunkData(out, chunk.Data)
+}
+
+type TileChunk struct {
+	TileCoordinates
+	Data []byte
+}
+
+func ReadTileCoordinates(in io.Reader, target *TileCoordinates) error {
+	if err := Read(in, &target.X); err != nil {
+		return fmt.Errorf("error reading tile x coordinate: %w", err)
+	}
+	if err := Read(in, &target.Y); err != nil {
+		return fmt.Errorf("error reading tile y coordinate: %w", err)
+	}
+	if err := Read(in, &target.LevelX); err != nil {
+		return fmt.Errorf("error reading tile x level: %w", err)
+	}
+	if err := Read(in, &target.LevelY); err != nil {
+		return fmt.Errorf("error reading tile y level: %w", err)
+	}
+	return nil
+}
+
+func WriteTileCoordinates(out io.Writer, coordinates TileCoordinates) error {
+	if err := Write(out, coordinates); err != nil {
+		return fmt.Errorf("error writing tile coordinates: %w", err)
+	}
+	return nil
+}
+
+type TileCoordinates struct {
+	X      int32
+	Y      int32
+	LevelX int32
+	LevelY int32
+}
+
+// Level returns the level that the tile belongs to.
+func (c TileCoordinates) Level() Level {
+	return Level{X: int(c.LevelX), Y: int(c.LevelY)}
+}
@@ -10,6 +10,10 @@ func ReadVersion(in io.Reader, target *Version) error {
 	return Read(in, target)
 }
 
+func WriteVersion(out io.Writer, version Version) error {
+	return Write(out, version)
+}
+
 type Version int32
 
 func (v Version) Number() int {
@@ -28,3 +32,13 @@ const (
 	FlagNonImage   Flag = 1 << 10 // one at 11-th bit in version
 	FlagMultipart  Flag = 1 << 11 // one at 12-th bit in version
 )
+
+const (
+	// MaxShortNameLength is the maximum length of attribute names, type
+	// names and channel names in images without the FlagLongName flag.
+	MaxShortNameLength = 31
+
+	// MaxLongNameLength is the maximum length of attribute names, type
+	// names and channel names in images with the FlagLongName flag.
+	MaxLongNameLength = 255
+)
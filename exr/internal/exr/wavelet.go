@@ -0,0 +1,173 @@
+package exr
+
+// The wavelet transform implemented here follows the one used by the PIZ
+// compression in the OpenEXR reference implementation (ImfWav.cpp).
+
+const (
+	wavNBits   = 16
+	wavAOffset = 1 << (wavNBits - 1)
+	wavMOffset = 1 << (wavNBits - 1)
+	wavModMask = (1 << wavNBits) - 1
+)
+
+func wenc14(a, b uint16) (uint16, uint16) {
+	as := int(int16(a))
+	bs := int(int16(b))
+	ms := (as + bs) >> 1
+	ds := as - bs
+	return uint16(int16(ms)), uint16(int16(ds))
+}
+
+func wenc16(a, b uint16) (uint16, uint16) {
+	ao := (int(a) + wavAOffset) & wavModMask
+	m := (ao + int(b)) >> 1
+	d := ao - int(b)
+	if d < 0 {
+		m = (m + wavMOffset) & wavModMask
+	}
+	d &= wavModMask
+	return uint16(m), uint16(d)
+}
+
+func wdec14(l, h uint16) (uint16, uint16) {
+	ls := int(int16(l))
+	hs := int(int16(h))
+	ai := ls + (hs & 1) + (hs >> 1)
+	as := int16(ai)
+	bs := int16(ai - hs)
+	return uint16(as), uint16(bs)
+}
+
+func wdec16(l, h uint16) (uint16, uint16) {
+	m := int(l)
+	d := int(h)
+	bb := (m - (d >> 1)) & wavModMask
+	aa := (d + bb - wavAOffset) & wavModMask
+	return uint16(aa), uint16(bb)
+}
+
+// wav2Encode applies an in-place 2D Haar wavelet transform on the nx by ny
+// values in data, where ox and oy are the offsets between neighbouring
+// values in the x and y directions and mx is the maximum value. It is the
+// inverse of wav2Decode.
+func wav2Encode(data []uint16, nx, ox, ny, oy int, mx uint16) {
+	wenc := wenc16
+	if mx < (1 << 14) {
+		wenc = wenc14
+	}
+
+	n := ny
+	if nx < n {
+		n = nx
+	}
+	p := 1
+	p2 := 2
+
+	for p2 <= n {
+		py := 0
+		ey := oy * (ny - p2)
+		oy1 := oy * p
+		oy2 := oy * p2
+		ox1 := ox * p
+		ox2 := ox * p2
+
+		for ; py <= ey; py += oy2 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				p10 := px + oy1
+				p11 := p10 + ox1
+
+				i00, i01 := wenc(data[px], data[p01])
+				i10, i11 := wenc(data[p10], data[p11])
+				data[px], data[p10] = wenc(i00, i10)
+				data[p01], data[p11] = wenc(i01, i11)
+			}
+
+			// encode (1D) odd column
+			if nx&p != 0 {
+				p10 := px + oy1
+				data[px], data[p10] = wenc(data[px], data[p10])
+			}
+		}
+
+		// encode (1D) odd line
+		if ny&p != 0 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				data[px], data[p01] = wenc(data[px], data[p01])
+			}
+		}
+
+		p = p2
+		p2 <<= 1
+	}
+}
+
+// wav2Decode applies an in-place 2D inverse Haar wavelet transform on the
+// nx by ny values in data, where ox and oy are the offsets between
+// neighbouring values in the x and y directions and mx is the maximum value.
+func wav2Decode(data []uint16, nx, ox, ny, oy int, mx uint16) {
+	wdec := wdec16
+	if mx < (1 << 14) {
+		wdec = wdec14
+	}
+
+	n := ny
+	if nx < n {
+		n = nx
+	}
+	p := 1
+	for p <= n {
+		p <<= 1
+	}
+	p >>= 1
+	p2 := p
+	p >>= 1
+
+	for p >= 1 {
+		py := 0
+		ey := oy * (ny - p2)
+		oy1 := oy * p
+		oy2 := oy * p2
+		ox1 := ox * p
+		ox2 := ox * p2
+
+		for ; py <= ey; py += oy2 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				p10 := px + oy1
+				p11 := p10 + ox1
+
+				i00, i10 := wdec(data[px], data[p10])
+				i01, i11 := wdec(data[p01], data[p11])
+				data[px], data[p01] = wdec(i00, i01)
+				data[p10], data[p11] = wdec(i10, i11)
+			}
+
+			// decode (1D) odd column
+			if nx&p != 0 {
+				p10 := px + oy1
+				data[px], data[p10] = wdec(data[px], data[p10])
+			}
+		}
+
+		// decode (1D) odd line
+		if ny&p != 0 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				data[px], data[p01] = wdec(data[px], data[p01])
+			}
+		}
+
+		p2 = p
+		p >>= 1
+	}
+}
@@ -0,0 +1,92 @@
+package exr
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// Level describes a single resolution level of an EXR image.
+//
+// Scan line images and tiled images that use the ONE_LEVEL mode have a
+// single level with index (0, 0). Tiled images that use the MIPMAP_LEVELS
+// mode have levels where X and Y are equal, whereas images that use the
+// RIPMAP_LEVELS mode have a level for every combination of X and Y.
+type Level struct {
+
+	// X holds the level index in the x direction.
+	X int
+
+	// Y holds the level index in the y direction.
+	Y int
+
+	// Width holds the width of the level in pixels.
+	Width int
+
+	// Height holds the height of the level in pixels.
+	Height int
+}
+
+// DecodeLevels returns the resolution levels of an EXR image without
+// decoding the entire image.
+//
+// The levels are returned in the order in which they are stored in the
+// image, which always starts with the full resolution level (0, 0). The
+// dimensions of each level are derived from the data window of the image,
+// following the rounding mode of the image. For multipart images, the
+// levels of the first part are returned.
+func DecodeLevels(in io.Reader) ([]Level, error) {
+	_, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	header := headers[0]
+
+	dataWindow := header.DataWindow
+	if dataWindow.Width() <= 0 || dataWindow.Height() <= 0 {
+		return nil, fmt.Errorf("invalid data window size (%d x %d)", dataWindow.Width(), dataWindow.Height())
+	}
+
+	if !header.Type.IsTiled() {
+		return []Level{
+			{
+				Width:  int(dataWindow.Width()),
+				Height: int(dataWindow.Height()),
+			},
+		}, nil
+	}
+
+	tiles := header.Tiles
+	if err := tiles.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tiles: %w", err)
+	}
+	tileLevels := tiles.Levels(dataWindow)
+	levels := make([]Level, len(tileLevels))
+	for i, tileLevel := range tileLevels {
+		levelWindow := tiles.LevelWindow(dataWindow, tileLevel)
+		levels[i] = Level{
+			X:      tileLevel.X,
+			Y:      tileLevel.Y,
+			Width:  int(levelWindow.Width()),
+			Height: int(levelWindow.Height()),
+		}
+	}
+	return levels, nil
+}
+
+// DecodeLevel reads the (x, y) resolution level of an EXR image from in.
+//
+// Level (0, 0) is decoded in the same way as with Decode. All other levels
+// have bounds that start at the origin of the data window of the image and
+// span the dimensions of the level.
+//
+// For multipart images, the level is taken from the first part. The same
+// restrictions that apply to Decode apply here as well.
+func DecodeLevel(in io.Reader, x, y int) (*RGBAImage, error) {
+	version, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	return decodePart(in, version, headers, 0, exr.Level{X: x, Y: y}, 0)
+}
@@ -0,0 +1,156 @@
+package exr_test
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestDecodeLevels(t *testing.T) {
+	// The data window is 7x5 pixels.
+	dataWindow := internal.Box2i{XMin: 10, YMin: -3, XMax: 16, YMax: 1}
+	testCases := []struct {
+		name   string
+		tiles  *internal.TileDescription
+		levels []exr.Level
+	}{
+		{
+			name: "scan line",
+			levels: []exr.Level{
+				{X: 0, Y: 0, Width: 7, Height: 5},
+			},
+		},
+		{
+			name:  "one level",
+			tiles: &internal.TileDescription{XSize: 2, YSize: 2, LevelMode: internal.LevelModeOne},
+			levels: []exr.Level{
+				{X: 0, Y: 0, Width: 7, Height: 5},
+			},
+		},
+		{
+			name:  "mipmap rounded down",
+			tiles: &internal.TileDescription{XSize: 2, YSize: 2, LevelMode: internal.LevelModeMipmap, RoundingMode: internal.RoundingModeDown},
+			levels: []exr.Level{
+				{X: 0, Y: 0, Width: 7, Height: 5},
+				{X: 1, Y: 1, Width: 3, Height: 2},
+				{X: 2, Y: 2, Width: 1, Height: 1},
+			},
+		},
+		{
+			name:  "mipmap rounded up",
+			tiles: &internal.TileDescription{XSize: 2, YSize: 2, LevelMode: internal.LevelModeMipmap, RoundingMode: internal.RoundingModeUp},
+			levels: []exr.Level{
+				{X: 0, Y: 0, Width: 7, Height: 5},
+				{X: 1, Y: 1, Width: 4, Height: 3},
+				{X: 2, Y: 2, Width: 2, Height: 2},
+				{X: 3, Y: 3, Width: 1, Height: 1},
+			},
+		},
+		{
+			name:  "ripmap rounded down",
+			tiles: &internal.TileDescription{XSize: 2, YSize: 2, LevelMode: internal.LevelModeRipmap, RoundingMode: internal.RoundingModeDown},
+			levels: []exr.Level{
+				{X: 0, Y: 0, Width: 7, Height: 5},
+				{X: 1, Y: 0, Width: 3, Height: 5},
+				{X: 2, Y: 0, Width: 1, Height: 5},
+				{X: 0, Y: 1, Width: 7, Height: 2},
+				{X: 1, Y: 1, Width: 3, Height: 2},
+				{X: 2, Y: 1, Width: 1, Height: 2},
+				{X: 0, Y: 2, Width: 7, Height: 1},
+				{X: 1, Y: 2, Width: 3, Height: 1},
+				{X: 2, Y: 2, Width: 1, Height: 1},
+			},
+		},
+		{
+			name:  "ripmap rounded up",
+			tiles: &internal.TileDescription{XSize: 2, YSize: 2, LevelMode: internal.LevelModeRipmap, RoundingMode: internal.RoundingModeUp},
+			levels: []exr.Level{
+				{X: 0, Y: 0, Width: 7, Height: 5},
+				{X: 1, Y: 0, Width: 4, Height: 5},
+				{X: 2, Y: 0, Width: 2, Height: 5},
+				{X: 3, Y: 0, Width: 1, Height: 5},
+				{X: 0, Y: 1, Width: 7, Height: 3},
+				{X: 1, Y: 1, Width: 4, Height: 3},
+				{X: 2, Y: 1, Width: 2, Height: 3},
+				{X: 3, Y: 1, Width: 1, Height: 3},
+				{X: 0, Y: 2, Width: 7, Height: 2},
+				{X: 1, Y: 2, Width: 4, Height: 2},
+				{X: 2, Y: 2, Width: 2, Height: 2},
+				{X: 3, Y: 2, Width: 1, Height: 2},
+				{X: 0, Y: 3, Width: 7, Height: 1},
+				{X: 1, Y: 3, Width: 4, Height: 1},
+				{X: 2, Y: 3, Width: 2, Height: 1},
+				{X: 3, Y: 3, Width: 1, Height: 1},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		img := &testImage{
+			header: newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat)),
+		}
+		if tc.tiles != nil {
+			img.header.Type = internal.PartTypeTiled
+			img.header.Tiles = *tc.tiles
+		}
+		levels, err := exr.DecodeLevels(bytes.NewReader(img.bytes(t)))
+		if err != nil {
+			t.Fatalf("%s: error decoding levels: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(levels, tc.levels) {
+			t.Fatalf("%s: got levels %v, want %v", tc.name, levels, tc.levels)
+		}
+	}
+}
+
+func TestDecodeLevel(t *testing.T) {
+	value := func(level internal.Level, channel int, x, y int32) float32 {
+		return float32(level.X*100+level.Y*10) + float32(x)*0.5 + float32(y)*0.25
+	}
+
+	dataWindow := internal.Box2i{XMin: 10, YMin: -3, XMax: 16, YMax: 1}
+	img := &testImage{
+		header: newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat)),
+	}
+	img.header.Type = internal.PartTypeTiled
+	img.header.Tiles = internal.TileDescription{
+		XSize:        2,
+		YSize:        2,
+		LevelMode:    internal.LevelModeRipmap,
+		RoundingMode: internal.RoundingModeDown,
+	}
+	img.addTiles(t, value)
+	data := img.bytes(t)
+
+	levels, err := exr.DecodeLevels(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding levels: %v", err)
+	}
+	for _, level := range levels {
+		decoded, err := exr.DecodeLevel(bytes.NewReader(data), level.X, level.Y)
+		if err != nil {
+			t.Fatalf("level (%d, %d): error decoding level: %v", level.X, level.Y, err)
+		}
+		bounds := image.Rect(10, -3, 10+level.Width, -3+level.Height)
+		if decoded.Bounds() != bounds {
+			t.Fatalf("level (%d, %d): got bounds %v, want %v", level.X, level.Y, decoded.Bounds(), bounds)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := value(internal.Level{X: level.X, Y: level.Y}, 0, int32(x), int32(y))
+				if got := decoded.At(x, y).(exr.RGBAColor).R; got != want {
+					t.Fatalf("level (%d, %d), pixel (%d, %d): got %v, want %v", level.X, level.Y, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	for _, level := range []exr.Level{{X: 3, Y: 0}, {X: 0, Y: 3}, {X: -1, Y: 0}} {
+		if _, err := exr.DecodeLevel(bytes.NewReader(data), level.X, level.Y); err == nil {
+			t.Fatalf("level (%d, %d): expected an error", level.X, level.Y)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package exr
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+const (
+	// PartTypeScanLine indicates a part that stores its pixels in scan
+	// line blocks.
+	PartTypeScanLine PartType = PartType(exr.PartTypeScanLine)
+
+	// PartTypeTiled indicates a part that stores its pixels in tiles.
+	PartTypeTiled PartType = PartType(exr.PartTypeTiled)
+
+	// PartTypeDeepScanLine indicates a part that stores deep data in scan
+	// line blocks.
+	PartTypeDeepScanLine PartType = PartType(exr.PartTypeDeepScanLine)
+
+	// PartTypeDeepTiled indicates a part that stores deep data in tiles.
+	PartTypeDeepTiled PartType = PartType(exr.PartTypeDeepTiled)
+)
+
+// PartType represents the way in which the data of a part is stored.
+type PartType string
+
+// Part describes a single part of an EXR image.
+//
+// Single-part images are represented by a single Part, which has an empty
+// name, unless the image specifies one.
+type Part struct {
+
+	// Name holds the unique name of the part.
+	Name string
+
+	// Type holds the type of the part.
+	Type PartType
+}
+
+// DecodeParts returns the parts of an EXR image without decoding the
+// entire image.
+//
+// The parts are returned in the order in which they are stored in the
+// image.
+func DecodeParts(in io.Reader) ([]Part, error) {
+	_, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	return newParts(headers), nil
+}
+
+func newParts(headers []exr.Header) []Part {
+	parts := make([]Part, len(headers))
+	for i, header := range headers {
+		parts[i] = Part{
+			Name: header.Name,
+			Type: PartType(header.Type),
+		}
+	}
+	return parts
+}
+
+// DecodePart reads the part with the specified name from an EXR image.
+//
+// Only the highest resolution level of tiled parts is decoded. The same
+// restrictions that apply to Decode apply here as well.
+func DecodePart(in io.Reader, name string) (*RGBAImage, error) {
+	version, headers, err := readHeaders(in)
+	if err != nil {
+		return nil, err
+	}
+	for i, header := range headers {
+		if header.Name == name {
+			return decodePart(in, version, headers, i, exr.Level{}, 0)
+		}
+	}
+	return nil, fmt.Errorf("part %q not found", name)
+}
@@ -0,0 +1,154 @@
+package exr_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// newTestMultipartImage returns an image with two scan line parts and a
+// tiled part in between, whose chunks are interleaved. The value of each
+// pixel depends on the index of the part.
+func newTestMultipartImage(t *testing.T) (*testMultipartImage, func(part int, x, y int32) float32) {
+	value := func(part int, x, y int32) float32 {
+		return float32(part*100) + float32(x) + float32(y)*10
+	}
+	displayWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 4, YMax: 4}
+	dataWindows := []internal.Box2i{
+		{XMin: 0, YMin: 0, XMax: 3, YMax: 2},
+		{XMin: 0, YMin: 0, XMax: 4, YMax: 3},
+		{XMin: 1, YMin: 1, XMax: 2, YMax: 4},
+	}
+	names := []string{"beauty", "depth", "aov"}
+
+	img := &testMultipartImage{}
+	partChunks := make([][]testChunk, len(names))
+	for part, name := range names {
+		partImg := &testImage{
+			header: newTestHeader(dataWindows[part], displayWindow, newTestChannel("R", internal.PixelTypeFloat)),
+		}
+		partImg.header.Name = name
+		partValue := func(channel int, x, y int32) float32 {
+			return value(part, x, y)
+		}
+		if part == 1 {
+			partImg.header.Type = internal.PartTypeTiled
+			partImg.header.Tiles = internal.TileDescription{XSize: 2, YSize: 2}
+			partImg.addTiles(t, func(level internal.Level, channel int, x, y int32) float32 {
+				return partValue(channel, x, y)
+			})
+		} else {
+			window := dataWindows[part]
+			for y := window.YMin; y <= window.YMax; y++ {
+				block := internal.Box2i{XMin: window.XMin, YMin: y, XMax: window.XMax, YMax: y}
+				partImg.chunks = append(partImg.chunks, testChunk{
+					index: len(partImg.chunks),
+					data:  scanLineChunk(t, y, blockData(partImg.header.Channels, block, partValue)),
+				})
+			}
+		}
+		partImg.header.ChunkCount = int32(len(partImg.chunks))
+		img.headers = append(img.headers, partImg.header)
+		partChunks[part] = partImg.chunks
+	}
+
+	for i := 0; ; i++ {
+		added := false
+		for part, chunks := range partChunks {
+			if i < len(chunks) {
+				img.chunks = append(img.chunks, testPartChunk{part: part, testChunk: chunks[i]})
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return img, value
+}
+
+func TestDecodeMultipart(t *testing.T) {
+	img, value := newTestMultipartImage(t)
+	data := img.bytes(t)
+
+	parts, err := exr.DecodeParts(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding parts: %v", err)
+	}
+	wantParts := []exr.Part{
+		{Name: "beauty", Type: exr.PartTypeScanLine},
+		{Name: "depth", Type: exr.PartTypeTiled},
+		{Name: "aov", Type: exr.PartTypeScanLine},
+	}
+	if !reflect.DeepEqual(parts, wantParts) {
+		t.Fatalf("got parts %v, want %v", parts, wantParts)
+	}
+
+	checkPart := func(name string, part int, decoded image.Image) {
+		t.Helper()
+		window := img.headers[part].DataWindow
+		bounds := image.Rect(int(window.XMin), int(window.YMin), int(window.XMax)+1, int(window.YMax)+1)
+		if decoded.Bounds() != bounds {
+			t.Fatalf("%s: got bounds %v, want %v", name, decoded.Bounds(), bounds)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if got, want := decoded.At(x, y).(exr.RGBAColor).R, value(part, int32(x), int32(y)); got != want {
+					t.Fatalf("%s: pixel (%d, %d): got %v, want %v", name, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	decoded, err := exr.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error decoding image: %v", err)
+	}
+	checkPart("Decode", 0, decoded)
+
+	for part, header := range img.headers {
+		decoded, err := exr.DecodePart(bytes.NewReader(data), header.Name)
+		if err != nil {
+			t.Fatalf("error decoding part %q: %v", header.Name, err)
+		}
+		checkPart(header.Name, part, decoded)
+
+		decoder, err := exr.NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder.Part = header.Name
+		decoded, err = decoder.Decode()
+		if err != nil {
+			t.Fatalf("error decoding part %q with decoder: %v", header.Name, err)
+		}
+		checkPart(header.Name, part, decoded)
+	}
+
+	if _, err := exr.DecodePart(bytes.NewReader(data), "missing"); err == nil {
+		t.Fatalf("expected an error for a missing part")
+	}
+}
+
+func TestDecodeMultipartInvalidPartNumber(t *testing.T) {
+	img, _ := newTestMultipartImage(t)
+	data := img.bytes(t)
+
+	// The chunks are stored at the end of the file, each of them prefixed
+	// with its part number.
+	chunksSize := 0
+	for _, chunk := range img.chunks {
+		chunksSize += 4 + len(chunk.data)
+	}
+	for _, partNumber := range []int32{-1, 3} {
+		binary.LittleEndian.PutUint32(data[len(data)-chunksSize:], uint32(partNumber))
+		if _, err := exr.DecodePart(bytes.NewReader(data), "aov"); err == nil {
+			t.Fatalf("part number %d: expected an error", partNumber)
+		}
+	}
+}
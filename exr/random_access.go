@@ -0,0 +1,283 @@
+package exr
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/mokiat/goexr/exr/internal/exr"
+)
+
+// Decoder decodes EXR images that can be accessed randomly.
+//
+// Unlike Decode, which has to read through the whole image, a Decoder
+// keeps the chunk offset tables of the image and reads only the chunks
+// that are needed, directly from their offsets. This makes it possible
+// to decode a range of lines of an image without reading all of it.
+type Decoder struct {
+
+	// Part holds the name of the part that is decoded. If it is empty,
+	// the first part of the image is decoded.
+	Part string
+
+	// Workers holds the maximum number of chunks that are decompressed
+	// concurrently. Chunks are decompressed one after another, on the
+	// calling goroutine, if it is less than two.
+	Workers int
+
+	in      io.ReaderAt
+	version exr.Version
+	headers []exr.Header
+	offsets [][]uint64
+}
+
+// NewDecoder creates a new Decoder that reads from in, which needs to
+// implement either io.ReaderAt or io.ReadSeeker.
+//
+// The headers and offset tables of the image are read right away.
+func NewDecoder(in io.Reader) (*Decoder, error) {
+	switch in := in.(type) {
+	case io.ReaderAt:
+		return newDecoder(in)
+	case io.ReadSeeker:
+		return newDecoder(&readSeekerAt{in: in})
+	default:
+		return nil, fmt.Errorf("reader supports neither io.ReaderAt nor io.ReadSeeker")
+	}
+}
+
+func newDecoder(in io.ReaderAt) (*Decoder, error) {
+	headerIn := bufio.NewReader(io.NewSectionReader(in, 0, math.MaxInt64))
+	version, headers, err := readHeaders(headerIn)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := readOffsets(headerIn, version, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decoder{
+		in:      in,
+		version: version,
+		headers: headers,
+		offsets: offsets,
+	}, nil
+}
+
+// DecodeRegion reads the pixels of an EXR image that lie within rect. Only
+// the chunks that overlap rect are read and pixel data is allocated only
+// for the pixels within rect.
+//
+// The bounds of the returned image are equal to rect, clipped to the
+// bounds that Decode would return. For multipart images, the region is
+// read from the first part. The same restrictions that apply to Decode
+// apply here as well.
+func DecodeRegion(in io.ReaderAt, rect image.Rectangle) (*RGBAImage, error) {
+	decoder, err := newDecoder(in)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.DecodeRegion(rect)
+}
+
+// Parts returns the parts of the image.
+func (d *Decoder) Parts() []Part {
+	return newParts(d.headers)
+}
+
+// Decode reads the whole image of the selected part. For tiled images only
+// the highest resolution level is read.
+//
+// The same restrictions that apply to the Decode function apply here as
+// well.
+func (d *Decoder) Decode() (*RGBAImage, error) {
+	part, err := d.part()
+	if err != nil {
+		return nil, err
+	}
+	return d.decodeWindow(part, d.headers[part].DataWindow)
+}
+
+// DecodeLines reads the lines in the range [yMin, yMax) of the selected
+// part. Only the chunks that hold these lines are read.
+//
+// The bounds of the returned image are limited to the specified lines.
+func (d *Decoder) DecodeLines(yMin, yMax int) (*RGBAImage, error) {
+	part, err := d.part()
+	if err != nil {
+		return nil, err
+	}
+	dataWindow := d.headers[part].DataWindow
+	return d.DecodeRegion(image.Rect(int(dataWindow.XMin), yMin, int(dataWindow.XMax)+1, yMax))
+}
+
+// DecodeRegion reads the pixels of the selected part that lie within rect.
+// Only the chunks that overlap rect are read and pixel data is allocated
+// only for the pixels within rect.
+//
+// The bounds of the returned image are equal to rect, clipped to the
+// bounds that Decode would return.
+func (d *Decoder) DecodeRegion(rect image.Rectangle) (*RGBAImage, error) {
+	part, err := d.part()
+	if err != nil {
+		return nil, err
+	}
+	dataWindow := d.headers[part].DataWindow
+	dataRect := boxToRect(dataWindow).Intersect(rect)
+	if dataRect.Empty() {
+		return nil, fmt.Errorf("region %v outside of data window", rect)
+	}
+	return d.decodeWindow(part, exr.Box2i{
+		XMin: int32(dataRect.Min.X),
+		YMin: int32(dataRect.Min.Y),
+		XMax: int32(dataRect.Max.X - 1),
+		YMax: int32(dataRect.Max.Y - 1),
+	})
+}
+
+func (d *Decoder) part() (int, error) {
+	if d.Part == "" {
+		return 0, nil
+	}
+	for i, header := range d.headers {
+		if header.Name == d.Part {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("part %q not found", d.Part)
+}
+
+// decodeWindow decodes the chunks of the specified part that overlap the
+// specified window.
+func (d *Decoder) decodeWindow(part int, window exr.Box2i) (*RGBAImage, error) {
+	header := d.headers[part]
+
+	var (
+		img         *RGBAImage
+		decodeChunk chunkDecoder
+		err         error
+	)
+	switch header.Type {
+	case exr.PartTypeScanLine:
+		img, decodeChunk, err = newScanLineDecoder(header, window)
+	case exr.PartTypeTiled:
+		img, decodeChunk, err = newTiledDecoder(header, exr.Level{}, window)
+	case exr.PartTypeDeepScanLine, exr.PartTypeDeepTiled:
+		return nil, fmt.Errorf("deep data not supported")
+	default:
+		return nil, fmt.Errorf("unsupported part type %q", header.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img.attributes = newAttributes(header)
+
+	indices, err := chunkIndices(header, window)
+	if err != nil {
+		return nil, err
+	}
+	runner := newChunkRunner(d.Workers)
+	readChunks := func() error {
+		for _, index := range indices {
+			if runner.Err() != nil {
+				break
+			}
+			task, err := d.readChunk(part, index, decodeChunk)
+			if err != nil {
+				return err
+			}
+			runner.Run(task)
+		}
+		return nil
+	}
+	err = readChunks()
+	if waitErr := runner.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// readChunk reads the chunk with the specified index in the offset table
+// of the specified part and returns the task that decodes it.
+func (d *Decoder) readChunk(part, index int, decodeChunk chunkDecoder) (chunkTask, error) {
+	if index < 0 || index >= len(d.offsets[part]) {
+		return nil, fmt.Errorf("chunk %d not found", index)
+	}
+	offset := d.offsets[part][index]
+	if offset > math.MaxInt64 {
+		return nil, fmt.Errorf("invalid chunk offset %d", offset)
+	}
+	in := io.NewSectionReader(d.in, int64(offset), math.MaxInt64-int64(offset))
+
+	if d.version.HasFlag(exr.FlagMultipart) {
+		var partNumber int32
+		if err := exr.ReadPartNumber(in, len(d.headers), &partNumber); err != nil {
+			return nil, fmt.Errorf("error reading chunk: %w", err)
+		}
+		if int(partNumber) != part {
+			return nil, fmt.Errorf("chunk at offset %d belongs to part %d", offset, partNumber)
+		}
+	}
+	return decodeChunk(in)
+}
+
+// chunkIndices returns the indices in the offset table of the chunks of
+// the highest resolution level of a part that overlap the specified window.
+func chunkIndices(header exr.Header, window exr.Box2i) ([]int, error) {
+	dataWindow := header.DataWindow
+	if header.Type.IsTiled() {
+		tiles := header.Tiles
+		xSize, ySize := int(tiles.XSize), int(tiles.YSize)
+		xMin := (int(window.XMin) - int(dataWindow.XMin)) / xSize
+		xMax := (int(window.XMax) - int(dataWindow.XMin)) / xSize
+		yMin := (int(window.YMin) - int(dataWindow.YMin)) / ySize
+		yMax := (int(window.YMax) - int(dataWindow.YMin)) / ySize
+		var indices []int
+		for tileY := yMin; tileY <= yMax; tileY++ {
+			for tileX := xMin; tileX <= xMax; tileX++ {
+				indices = append(indices, tiles.ChunkIndex(dataWindow, exr.Level{}, tileX, tileY))
+			}
+		}
+		return indices, nil
+	}
+
+	first, err := exr.ScanLineChunkIndex(dataWindow, header.Compression, window.YMin)
+	if err != nil {
+		return nil, err
+	}
+	last, err := exr.ScanLineChunkIndex(dataWindow, header.Compression, window.YMax)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]int, 0, last-first+1)
+	for index := first; index <= last; index++ {
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// readSeekerAt implements io.ReaderAt on top of an io.ReadSeeker.
+type readSeekerAt struct {
+	mu sync.Mutex
+	in io.ReadSeeker
+}
+
+func (r *readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.in.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.in, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,139 @@
+package exr_test
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/mokiat/goexr/exr"
+	internal "github.com/mokiat/goexr/exr/internal/exr"
+)
+
+func TestDecodeRegion(t *testing.T) {
+	value := func(channel int, x, y int32) float32 {
+		return float32(channel) + float32(x)*0.5 + float32(y)*8
+	}
+
+	// The 9x40 data window is split into 16-line blocks or 4x3 tiles, so
+	// most regions cover only parts of some of the chunks.
+	dataWindow := internal.Box2i{XMin: -2, YMin: 3, XMax: 6, YMax: 42}
+	header := newTestHeader(dataWindow, dataWindow,
+		newTestChannel("G", internal.PixelTypeHalf),
+		newTestChannel("R", internal.PixelTypeFloat),
+	)
+
+	scanLine := &testImage{header: header}
+	scanLine.header.Compression = internal.CompressionZIP
+	for y := dataWindow.YMin; y <= dataWindow.YMax; y += 16 {
+		block := internal.Box2i{XMin: dataWindow.XMin, YMin: y, XMax: dataWindow.XMax, YMax: y + 15}
+		if block.YMax > dataWindow.YMax {
+			block.YMax = dataWindow.YMax
+		}
+		scanLine.chunks = append(scanLine.chunks, testChunk{
+			index: len(scanLine.chunks),
+			data:  scanLineChunk(t, y, zipCompress(t, blockData(header.Channels, block, value))),
+		})
+	}
+
+	tiled := &testImage{header: header}
+	tiled.header.Type = internal.PartTypeTiled
+	tiled.header.Tiles = internal.TileDescription{XSize: 4, YSize: 3}
+	tiled.addTiles(t, func(level internal.Level, channel int, x, y int32) float32 {
+		return value(channel, x, y)
+	})
+
+	regions := []image.Rectangle{
+		image.Rect(-2, 3, 7, 43),
+		image.Rect(-100, -100, 100, 100),
+		image.Rect(0, 10, 5, 30),
+		image.Rect(6, 42, 7, 43),
+		image.Rect(-5, 18, 1, 20),
+	}
+	for name, img := range map[string]*testImage{"scan line": scanLine, "tiled": tiled} {
+		data := img.bytes(t)
+		full, err := exr.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: error decoding image: %v", name, err)
+		}
+
+		for _, region := range regions {
+			decoded, err := exr.DecodeRegion(bytes.NewReader(data), region)
+			if err != nil {
+				t.Fatalf("%s: region %v: error decoding region: %v", name, region, err)
+			}
+			checkCrop(t, name, decoded, full, region)
+		}
+
+		decoder, err := exr.NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: error creating decoder: %v", name, err)
+		}
+		for _, lines := range [][2]int{{3, 43}, {10, 20}, {18, 19}, {0, 5}, {40, 100}} {
+			decoded, err := decoder.DecodeLines(lines[0], lines[1])
+			if err != nil {
+				t.Fatalf("%s: lines %v: error decoding lines: %v", name, lines, err)
+			}
+			checkCrop(t, name, decoded, full, image.Rect(-2, lines[0], 7, lines[1]))
+		}
+
+		if _, err := exr.DecodeRegion(bytes.NewReader(data), image.Rect(10, 3, 20, 43)); err == nil {
+			t.Fatalf("%s: expected an error for a region outside of the data window", name)
+		}
+		if _, err := decoder.DecodeLines(50, 60); err == nil {
+			t.Fatalf("%s: expected an error for lines outside of the data window", name)
+		}
+	}
+}
+
+func TestDecodeRegionSkipsChunks(t *testing.T) {
+	value := func(channel int, x, y int32) float32 {
+		return float32(x) + float32(y)*8
+	}
+
+	dataWindow := internal.Box2i{XMin: 0, YMin: 0, XMax: 3, YMax: 3}
+	img := &testImage{
+		header: newTestHeader(dataWindow, dataWindow, newTestChannel("R", internal.PixelTypeFloat)),
+	}
+	for y := int32(0); y <= 3; y++ {
+		block := internal.Box2i{XMin: 0, YMin: y, XMax: 3, YMax: y}
+		img.chunks = append(img.chunks, testChunk{index: int(y), data: scanLineChunk(t, y, blockData(img.header.Channels, block, value))})
+	}
+	// The chunk of the last line is invalid, which only matters when it is
+	// read.
+	img.chunks[3].data = scanLineChunk(t, 3, []byte{1, 2, 3})
+	data := img.bytes(t)
+
+	if _, err := exr.Decode(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expected an error for the invalid chunk")
+	}
+	decoded, err := exr.DecodeRegion(bytes.NewReader(data), image.Rect(1, 0, 3, 3))
+	if err != nil {
+		t.Fatalf("error decoding region: %v", err)
+	}
+	if want := image.Rect(1, 0, 3, 3); decoded.Bounds() != want {
+		t.Fatalf("got bounds %v, want %v", decoded.Bounds(), want)
+	}
+	for y := int32(0); y < 3; y++ {
+		for x := int32(1); x < 3; x++ {
+			if got, want := decoded.At(int(x), int(y)).(exr.RGBAColor).R, value(0, x, y); got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// checkCrop checks that img is the part of full that lies within rect.
+func checkCrop(t *testing.T, name string, img *exr.RGBAImage, full image.Image, rect image.Rectangle) {
+	t.Helper()
+	want := full.Bounds().Intersect(rect)
+	if img.Bounds() != want {
+		t.Fatalf("%s: region %v: got bounds %v, want %v", name, rect, img.Bounds(), want)
+	}
+	for y := want.Min.Y; y < want.Max.Y; y++ {
+		for x := want.Min.X; x < want.Max.X; x++ {
+			if got, want := img.At(x, y), full.At(x, y); got != want {
+				t.Fatalf("%s: region %v: pixel (%d, %d): got %v, want %v", name, rect, x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package exr
+
+import "sync"
+
+// chunkTask decodes a chunk that has already been read.
+type chunkTask func() error
+
+// newChunkRunner creates a chunkRunner that runs tasks on the specified
+// number of goroutines. Tasks are run right away, on the calling goroutine,
+// if the number of workers is less than two.
+func newChunkRunner(workers int) *chunkRunner {
+	runner := &chunkRunner{}
+	if workers < 2 {
+		return runner
+	}
+	runner.tasks = make(chan chunkTask, workers)
+	runner.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer runner.wg.Done()
+			for task := range runner.tasks {
+				if runner.Err() == nil {
+					runner.setErr(task())
+				}
+			}
+		}()
+	}
+	return runner
+}
+
+// chunkRunner runs the tasks of chunks, possibly concurrently, and keeps
+// track of the first error that occurs.
+type chunkRunner struct {
+	tasks chan chunkTask
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	err   error
+}
+
+// Run schedules the specified task. A nil task is ignored.
+func (r *chunkRunner) Run(task chunkTask) {
+	if task == nil {
+		return
+	}
+	if r.tasks == nil {
+		r.setErr(task())
+		return
+	}
+	r.tasks <- task
+}
+
+// Err returns the first error that has been returned by a task so far.
+func (r *chunkRunner) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Wait waits for all scheduled tasks to complete and returns the first
+// error that has been returned by a task. No tasks can be scheduled after
+// Wait has been called.
+func (r *chunkRunner) Wait() error {
+	if r.tasks != nil {
+		close(r.tasks)
+		r.wg.Wait()
+	}
+	return r.Err()
+}
+
+func (r *chunkRunner) setErr(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}